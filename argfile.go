@@ -0,0 +1,96 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// The maximum depth of argument files including other argument files.
+const argFileMaxDepth = 10
+
+// Indicates whether or not argument files are expanded.
+var argFilesEnabled bool = false
+
+// Enables expanding argument files.  An argument of the form '@path' is replaced with the
+// arguments read from the file at path before any of the arguments are parsed.  Each line of
+// the file is split into arguments using shell-like quoting, with blank lines and lines starting
+// with '#' ignored.  Argument files may refer to other argument files, up to a depth of 10.  An
+// argument starting with '@@' is passed through as a literal argument with the leading '@'
+// removed.  Argument files which cannot be read fail the command line parsing with a
+// `TryParseArgFileError` reason.
+func ExpandArgFiles() {
+    argFilesEnabled = true
+}
+
+// Expands the argument files in arguments.  If an argument file cannot be expanded, returns
+// the index in arguments of the offending argument along with the error.
+func expandArgFiles(arguments []string, depth int) ([]string, int, error) {
+    expanded := make([]string, 0, len(arguments))
+    for i, arg := range arguments {
+        if strings.HasPrefix(arg, "@@") {
+            expanded = append(expanded, arg[1:])
+        } else if strings.HasPrefix(arg, "@") && (len(arg) > 1) {
+            if (depth >= argFileMaxDepth) {
+                return nil, i, errors.New(message("%s: argument files nested too deeply", arg[1:]))
+            }
+
+            fileArgs, err := readArgFile(arg[1:])
+            if err != nil {
+                return nil, i, err
+            }
+            fileArgs, _, err = expandArgFiles(fileArgs, depth + 1)
+            if err != nil {
+                return nil, i, err
+            }
+            expanded = append(expanded, fileArgs...)
+        } else {
+            expanded = append(expanded, arg)
+        }
+    }
+    return expanded, -1, nil
+}
+
+// Reads the arguments from an argument file.
+func readArgFile(filename string) ([]string, error) {
+    f, err := os.Open(filename)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    fileArgs := make([]string, 0)
+    scanner := bufio.NewScanner(f)
+    for lineNum := 1; scanner.Scan(); lineNum++ {
+        line := strings.TrimSpace(scanner.Text())
+        if (line == "") || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        lineArgs, err := splitCommandLine(line)
+        if err != nil {
+            return nil, fmt.Errorf("%s:%d: %v", filename, lineNum, err)
+        }
+        fileArgs = append(fileArgs, lineArgs...)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("%s: %v", filename, err)
+    }
+    return fileArgs, nil
+}
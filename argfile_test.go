@@ -0,0 +1,94 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Writes an argument file in the directory, returning its path.
+func writeArgFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Tests expanding argument files into global flags, commands and arguments
+func TestArgFiles(t *testing.T) {
+	dir := t.TempDir()
+	inner := writeArgFile(t, dir, "inner", "'arg two'\n")
+	outer := writeArgFile(t, dir, "outer", "# the command\n-global1=hello command1\n\n-flag1 arg1\n@"+inner+"\n")
+	resetForTesting("@"+outer, "@@literal")
+
+	ExpandArgFiles()
+	g1 := flag.String("global1", "default-global1", "Description about global1")
+	c1 := &testCmd1{}
+	On("command1", "", c1)
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if *g1 != "hello" || !*c1.flag1 {
+		t.Error("flags expected to be set from the argument file")
+	}
+	expected := []string{"arg1", "arg two", "@literal"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("args expected to be %q, was %q", expected, args)
+	}
+}
+
+// Tests argument files which cannot be expanded
+func TestArgFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	recursive := filepath.Join(dir, "recursive")
+	writeArgFile(t, dir, "recursive", "@"+recursive+"\n")
+	badQuote := writeArgFile(t, dir, "badquote", "command1 'foo\n")
+
+	for _, arg := range []string{"@" + filepath.Join(dir, "missing"), "@" + recursive, "@" + badQuote} {
+		resetForTesting("command1", arg)
+
+		ExpandArgFiles()
+		On("command1", "", &testCmd1{}).Arguments("...")
+		res := TryParse()
+		if res == nil || res.(TryParseError).Reason != TryParseArgFileError {
+			t.Errorf("%s: Try parse must be TryParseArgFileError, was %v", arg, res)
+			continue
+		}
+		parseErr := res.(TryParseError)
+		if !reflect.DeepEqual(parseErr.Args, []string{"cmd", "command1", arg}) || parseErr.Index != 2 || parseErr.Received != arg {
+			t.Errorf("%s: error must refer to the argument file, was %d %q in %q", arg, parseErr.Index, parseErr.Received, parseErr.Args)
+		}
+	}
+}
+
+// Tests that argument files are not expanded unless enabled
+func TestArgFilesDisabled(t *testing.T) {
+	resetForTesting("command1", "@somefile")
+
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if len(args) != 1 || args[0] != "@somefile" {
+		t.Errorf("args expected to be [@somefile], was %v", args)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// The input read when the batch file is "-".
+var batchInput io.Reader = os.Stdin
+
+// Where the batch summary is written.
+var batchOutput io.Writer = os.Stderr
+
+// Registers a batch command which runs the command lines in a file, or in stdin if the file is
+// "-", in order.  The global flags and pre-arguments given before 'batch' are kept for every
+// line.  Blank lines and lines starting with '#' are ignored, lines ending with a backslash are
+// continued on the next line, and lines are split into arguments using shell-like quoting.
+//
+// Running stops at the first line which fails unless '-keep-going' is given.  A line fails if
+// it cannot be parsed or its command exits with a non-zero status using `Exit`.  Once done, a
+// summary of the exit status of each line is printed and, if any line failed, the program
+// exits with the status of the first failure.
+func OnBatch() {
+    On("batch", "Runs the commands in a file", &batchCmd{}).
+        Arguments("file").
+        SupportsDryRun().
+        Long("Runs the command lines in a file, or in stdin if the file is '-', in order. " +
+            "Blank lines and lines starting with '#' are ignored, and lines ending with a " +
+            "backslash are continued on the next line. Running stops at the first line which " +
+            "fails unless -keep-going is given.")
+}
+
+// Builtin command for running a file of command lines.
+type batchCmd struct {
+    keepGoing   *bool
+}
+
+// A command line read from a batch file.
+type batchLine struct {
+    lineNum     int
+    text        string
+}
+
+// The result of running a batch line.
+type batchResult struct {
+    line        batchLine
+    status      int
+    skipped     bool
+}
+
+// Raised by `Exit` while running a batch line, to return the exit status to the batch command.
+type batchExit struct {
+    status      int
+}
+
+func (cmd *batchCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+    cmd.keepGoing = fs.Bool("keep-going", false, "Continues running the lines after a line fails")
+    return fs
+}
+
+func (cmd *batchCmd) Run(cmdArgs []string) {
+    filename := cmdArgs[0]
+    lines, err := readBatchFile(filename)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+        exit(1)
+        return
+    }
+
+    savedMatchingCmd, savedArgs, savedFlagHelp := matchingCmd, args, flagHelp
+    results := make([]batchResult, 0, len(lines))
+    failed := false
+    for _, line := range lines {
+        if failed && !*cmd.keepGoing {
+            results = append(results, batchResult{line: line, skipped: true})
+            continue
+        }
+        status := runBatchLine(line)
+        results = append(results, batchResult{line: line, status: status})
+        failed = failed || (status != 0)
+    }
+    matchingCmd, args, flagHelp = savedMatchingCmd, savedArgs, savedFlagHelp
+
+    firstFailure := printBatchSummary(filename, results)
+    if (firstFailure != 0) {
+        exit(firstFailure)
+    }
+}
+
+// Reads the command lines of a batch file, joining continued lines and dropping blank lines
+// and comments.
+func readBatchFile(filename string) ([]batchLine, error) {
+    input := batchInput
+    if (filename != "-") {
+        f, err := os.Open(filename)
+        if err != nil {
+            return nil, err
+        }
+        defer f.Close()
+        input = f
+    }
+
+    lines := make([]batchLine, 0)
+    var continued *batchLine = nil
+    scanner := bufio.NewScanner(input)
+    for lineNum := 1; scanner.Scan(); lineNum++ {
+        text := scanner.Text()
+        if (continued != nil) {
+            continued.text += text
+        } else if trimmed := strings.TrimSpace(text); (trimmed == "") || strings.HasPrefix(trimmed, "#") {
+            continue
+        } else {
+            continued = &batchLine{lineNum, text}
+        }
+
+        if strings.HasSuffix(continued.text, "\\") {
+            continued.text = strings.TrimSuffix(continued.text, "\\")
+            continue
+        }
+        lines = append(lines, *continued)
+        continued = nil
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("%s: %v", filename, err)
+    }
+    if (continued != nil) {
+        lines = append(lines, *continued)
+    }
+    return lines, nil
+}
+
+// Parses and runs a batch line, returning its exit status.  Calls to `Exit` made by the command
+// are caught so that the remaining lines can run.
+func runBatchLine(line batchLine) (status int) {
+    tokens, err := splitCommandLine(line.text)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", message("line %d: %v", line.lineNum, err))
+        return 1
+    } else if (len(tokens) == 0) {
+        return 0
+    }
+
+    if err := parseCommand(flag.CommandLine, tokens, 0); err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", message("line %d: %v", line.lineNum, err))
+        if highlight := err.(TryParseError).Highlight(); highlight != "" {
+            fmt.Fprintf(os.Stderr, "%s\n", highlight)
+        }
+        return 1
+    }
+
+    savedExit := exit
+    exit = func(code int) {
+        panic(batchExit{code})
+    }
+    defer func() {
+        exit = savedExit
+        if r := recover(); r != nil {
+            be, isBatchExit := r.(batchExit)
+            if (!isBatchExit) {
+                panic(r)
+            }
+            status = be.status
+        }
+    }()
+
+    Run()
+    return 0
+}
+
+// Prints the exit status of each batch line.  Returns the status of the first line which
+// failed, or 0 if every line succeeded.
+func printBatchSummary(filename string, results []batchResult) int {
+    firstFailure := 0
+    fmt.Fprintln(batchOutput, message("batch summary for %s:", filename))
+    for _, result := range results {
+        var status string
+        switch {
+        case result.skipped:
+            status = message("skipped")
+        case (result.status == 0):
+            status = message("ok")
+        default:
+            status = message("exit %d", result.status)
+            if (firstFailure == 0) {
+                firstFailure = result.status
+            }
+        }
+        fmt.Fprintf(batchOutput, "  %4d  %-8s  %s\n", result.line.lineNum, status, strings.TrimSpace(result.line.text))
+    }
+    return firstFailure
+}
@@ -0,0 +1,152 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A command which exits with the status given as its argument.
+type exitCmd struct{}
+
+func (cmd exitCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	return fs
+}
+
+func (cmd exitCmd) Run(args []string) {
+	if args[0] != "0" {
+		Exit(int(args[0][0] - '0'))
+	}
+}
+
+// Registers the batch command and commands to run in batch mode, capturing the summary.
+func batchForTesting(input string, arguments ...string) (*bytes.Buffer, *[]int) {
+	resetForTesting(arguments...)
+	batchInput = strings.NewReader(input)
+	out := new(bytes.Buffer)
+	batchOutput = out
+
+	statuses := make([]int, 0)
+	exit = func(code int) {
+		statuses = append(statuses, code)
+	}
+	On("exit", "", exitCmd{}).Arguments("status")
+	OnBatch()
+	return out, &statuses
+}
+
+// Tests reading a batch file with comments, quoting and continuations
+func TestReadBatchFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "commands.txt")
+	os.WriteFile(filename, []byte("# comment\ncommand1 'a b'\n\n  command2 \\\n  -flag2\n"), 0644)
+
+	lines, err := readBatchFile(filename)
+	if err != nil {
+		t.Fatal("batch file must be read, was", err)
+	}
+	if len(lines) != 2 || lines[0].lineNum != 2 || lines[1].lineNum != 4 {
+		t.Fatalf("two lines expected, was %+v", lines)
+	}
+	if lines[1].text != "  command2   -flag2" {
+		t.Errorf("continued line expected to be joined, was %q", lines[1].text)
+	}
+}
+
+// Tests that running stops at the first failure
+func TestBatchStopsOnError(t *testing.T) {
+	out, statuses := batchForTesting("exit 0\nexit 3\nexit 0\n", "batch", "-")
+	Parse()
+	Run()
+
+	expected := "batch summary for -:\n" +
+		"     1  ok        exit 0\n" +
+		"     2  exit 3    exit 3\n" +
+		"     3  skipped   exit 0\n"
+	if out.String() != expected {
+		t.Errorf("unexpected summary:\n%s", out.String())
+	}
+	if len(*statuses) != 1 || (*statuses)[0] != 3 {
+		t.Errorf("batch must exit with the first failing status, was %v", *statuses)
+	}
+	if matchingCmd != cmds["batch"] {
+		t.Error("matching command expected to be restored after the batch")
+	}
+}
+
+// Tests that running continues after failures with -keep-going
+func TestBatchKeepGoing(t *testing.T) {
+	out, statuses := batchForTesting("exit 2\nbadcommand\nexit 0\n", "batch", "-keep-going", "-")
+	Parse()
+	Run()
+
+	expected := "batch summary for -:\n" +
+		"     1  exit 2    exit 2\n" +
+		"     2  exit 1    badcommand\n" +
+		"     3  ok        exit 0\n"
+	if out.String() != expected {
+		t.Errorf("unexpected summary:\n%s", out.String())
+	}
+	if len(*statuses) != 1 || (*statuses)[0] != 2 {
+		t.Errorf("batch must exit with the first failing status, was %v", *statuses)
+	}
+}
+
+// Tests that the batch command does not add examples which need the program's pre-args
+func TestBatchCheckExamples(t *testing.T) {
+	batchForTesting("")
+	PreArg("pa", "")
+
+	if err := CheckExamples(); err != nil {
+		t.Error("examples must be valid, was", err)
+	}
+}
+
+// Tests that a signal received while running a batch line exits the program
+func TestBatchSignalExits(t *testing.T) {
+	_, statuses := batchForTesting("slow\n", "batch", "-")
+	signalStatus := make(chan int, 1)
+	signalExit = func(code int) { signalStatus <- code }
+
+	HandleSignals(10 * time.Millisecond)
+	On("slow", "", contextCmd(func(ctx context.Context) {
+		handleSignal(os.Interrupt)
+		select {
+		case status := <-signalStatus:
+			signalStatus <- status
+		case <-time.After(time.Second):
+		}
+	}))
+	Parse()
+	Run()
+
+	select {
+	case status := <-signalStatus:
+		if status != 130 {
+			t.Errorf("exit status expected to be 130, was %d", status)
+		}
+	default:
+		t.Error("program expected to exit after the grace period")
+	}
+	if len(*statuses) != 0 {
+		t.Errorf("batch line not expected to record the signal exit, was %v", *statuses)
+	}
+}
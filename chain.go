@@ -0,0 +1,151 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "flag"
+)
+
+// The argument separating chained commands, or the empty string if chaining is disabled.
+var chainSeparator string = ""
+
+// The commands matched by the last parse when more than one command is chained.
+var chain []chainLink = nil
+
+// The commands matched by the last parse, chained or not, used to bind their flags again once
+// the examples have been checked.
+var parsedLinks []chainLink = nil
+
+// A command matched as part of a chain.
+type chainLink struct {
+    cont        *cmdCont
+    args        []string
+    flagHelp    *bool
+
+    // The command line up to the end of the command's arguments, and the index of the command
+    // name in it, used to parse the command again before running it.
+    argv        []string
+    cmdIndex    int
+}
+
+// A command and its arguments, matched as part of a chain.
+type ChainedCommand struct {
+    Name        string
+    Args        []string
+}
+
+// Enables running several commands in one invocation, separated by the separator argument,
+// such as "+":
+//
+//      program -v build -fast + test ./... + publish
+//
+// The global flags and pre-arguments are parsed once and shared by the commands, and persistent
+// flags given after any of the commands apply to all of them.  Every command
+// is parsed by `TryParse`, so an error in any of them fails the parsing before any command is
+// run, and `Run` then runs the commands in order.  A command fails by exiting using `Exit` or
+// os.Exit, which ends the program without running the remaining commands.  The separator
+// always separates commands, even in the arguments of a command registered using `OnExec`.
+func ChainSeparator(separator string) {
+    chainSeparator = separator
+}
+
+// Returns the commands matched by the last parse, in the order they are run.  This is a single
+// command unless commands were chained using the separator set by `ChainSeparator`.
+func Chain() []ChainedCommand {
+    if (len(chain) == 0) {
+        if (matchingCmd == nil) {
+            return nil
+        }
+        return []ChainedCommand{{matchingCmd.name, args}}
+    }
+
+    chained := make([]ChainedCommand, 0, len(chain))
+    for _, link := range chain {
+        chained = append(chained, ChainedCommand{link.cont.name, link.args})
+    }
+    return chained
+}
+
+// Parses the commands starting at cmdIndex in argv, splitting them at the chain separator.
+// The matching command is set to the first command of the chain.
+func parseChain(globalFlags *flag.FlagSet, argv []string, cmdIndex int) error {
+    chain = nil
+    if (chainSeparator == "") {
+        if err := parseCommand(globalFlags, argv, cmdIndex); err != nil {
+            return err
+        }
+        parsedLinks = []chainLink{{matchingCmd, args, flagHelp, argv, cmdIndex}}
+        return nil
+    }
+
+    links := make([]chainLink, 0)
+    start := cmdIndex
+    for end := cmdIndex; end <= len(argv); end++ {
+        if (end < len(argv)) && (argv[end] != chainSeparator) {
+            continue
+        }
+        if (start == end) {
+            return newParseError(TryParseNoCommand, "", ErrMissingCommand, message("missing command"), argv).at(start, "<command>", "")
+        }
+
+        if err := parseCommand(globalFlags, argv[:end], start); err != nil {
+            // Report the error against the whole command line
+            parseErr := err.(TryParseError)
+            parseErr.Args = argv
+            return parseErr
+        }
+        links = append(links, chainLink{matchingCmd, args, flagHelp, argv[:end], start})
+        start = end + 1
+    }
+
+    // Persistent flags given after a later command apply to the whole chain, so check the
+    // commands against them once they have all been parsed
+    for _, link := range links {
+        if err := checkDryRun(globalFlags, link.cont, argv, link.cmdIndex); err != nil {
+            return err
+        }
+    }
+
+    matchingCmd, args, flagHelp = links[0].cont, links[0].args, links[0].flagHelp
+    parsedLinks = links
+    if (len(links) > 1) {
+        chain = links
+    }
+    return nil
+}
+
+// Runs the chained commands in order.
+func runChain() {
+    links := chain
+    chain = nil
+    defer func() {
+        chain = links
+    }()
+
+    seen := make(map[*cmdCont]int)
+    for _, link := range links {
+        seen[link.cont]++
+    }
+
+    for _, link := range links {
+        matchingCmd, args, flagHelp = link.cont, link.args, link.flagHelp
+        if (seen[link.cont] > 1) {
+            // The flags of a command which appears more than once are bound to the values of
+            // its last occurrence, so parse it again
+            parseCommand(flag.CommandLine, link.argv, link.cmdIndex)
+        }
+        runMatchingCmd()
+    }
+}
@@ -0,0 +1,142 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// A command which records the value of its flag and its arguments each time it is run.
+type recordingCmd struct {
+	name string
+	fast *bool
+	runs *[]string
+}
+
+func (cmd *recordingCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.fast = fs.Bool("fast", false, "")
+	return fs
+}
+
+func (cmd *recordingCmd) Run(args []string) {
+	run := cmd.name
+	if *cmd.fast {
+		run += " -fast"
+	}
+	for _, arg := range args {
+		run += " " + arg
+	}
+	*cmd.runs = append(*cmd.runs, run)
+}
+
+// Registers the recording commands, returning the list of runs.
+func chainForTesting(arguments ...string) *[]string {
+	resetForTesting(arguments...)
+	runs := make([]string, 0)
+	On("build", "", &recordingCmd{name: "build", runs: &runs})
+	On("test", "", &recordingCmd{name: "test", runs: &runs}).Arguments("...")
+	On("publish", "", &recordingCmd{name: "publish", runs: &runs}).Arguments("[target]")
+	ChainSeparator("+")
+	return &runs
+}
+
+// Tests running chained commands in order with shared global flags and pre-args
+func TestChain(t *testing.T) {
+	runs := chainForTesting("-global1=x", "pa", "build", "-fast", "+", "test", "./...", "+", "publish")
+	g1 := flag.String("global1", "", "")
+	prearg := PreArg("pa", "")
+
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	expectedChain := []ChainedCommand{{"build", []string{}}, {"test", []string{"./..."}}, {"publish", []string{}}}
+	if !reflect.DeepEqual(Chain(), expectedChain) {
+		t.Errorf("chain expected to be %v, was %v", expectedChain, Chain())
+	}
+
+	Run()
+	expectedRuns := []string{"build -fast", "test ./...", "publish"}
+	if !reflect.DeepEqual(*runs, expectedRuns) {
+		t.Errorf("runs expected to be %v, was %v", expectedRuns, *runs)
+	}
+	if *g1 != "x" || *prearg != "pa" {
+		t.Error("global flags and pre-args must be parsed once for the chain")
+	}
+}
+
+// Tests that a command appearing more than once is run with its own flags each time
+func TestChainRepeatedCommand(t *testing.T) {
+	runs := chainForTesting("build", "-fast", "+", "build")
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	Run()
+
+	expectedRuns := []string{"build -fast", "build"}
+	if !reflect.DeepEqual(*runs, expectedRuns) {
+		t.Errorf("runs expected to be %v, was %v", expectedRuns, *runs)
+	}
+}
+
+// Tests that an error in any chained command fails the parse before running anything
+func TestChainErrors(t *testing.T) {
+	runs := chainForTesting("build", "+", "publish", "a", "b", "+", "test")
+	err := TryParse()
+	if !errors.Is(err, ErrTooManyArguments) {
+		t.Fatal("try parse must fail for the second command, was", err)
+	}
+	if parseErr := err.(TryParseError); parseErr.Index != 5 || len(parseErr.Args) != 8 {
+		t.Errorf("error must refer to the whole command line, was %d %v", parseErr.Index, parseErr.Args)
+	}
+	if len(*runs) != 0 {
+		t.Error("no command must run when the chain fails to parse")
+	}
+
+	chainForTesting("build", "+")
+	if err := TryParse(); !errors.Is(err, ErrMissingCommand) {
+		t.Error("try parse must fail for a missing command after the separator, was", err)
+	}
+}
+
+// Tests that a persistent dry-run flag given after a later command applies to the whole chain
+func TestChainDryRun(t *testing.T) {
+	runs := chainForTesting("build", "+", "test", "-dry-run")
+	EnableDryRun()
+	cmds["test"].dryRun = true
+
+	err := TryParse()
+	if !errors.Is(err, ErrDryRunUnsupported) {
+		t.Fatal("try parse must fail for the command not supporting dry runs, was", err)
+	}
+	if parseErr := err.(TryParseError); parseErr.Index != 1 || parseErr.Received != "build" {
+		t.Errorf("error must refer to the first command, was %d %q", parseErr.Index, parseErr.Received)
+	}
+	if len(*runs) != 0 {
+		t.Error("no command must run when the chain fails to parse")
+	}
+}
+
+// Tests that the separator is an ordinary argument unless chaining is enabled
+func TestChainDisabled(t *testing.T) {
+	resetForTesting("test", "+", "publish")
+	c := &recordingCmd{name: "test", runs: new([]string)}
+	On("test", "", c).Arguments("...")
+	if err := TryParse(); err != nil || len(args) != 2 || args[0] != "+" {
+		t.Error("separator must be passed as an argument, was", err, args)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "os"
+)
+
+// The styles used for colored output.  Each style is the parameters of an ANSI SGR escape
+// sequence, such as "1" for bold or "1;31" for bold red.  The empty string leaves the text
+// unstyled.
+type Theme struct {
+    // Section headings, such as "Usage:" and "Available flags:".
+    Heading     string
+
+    // Command names.
+    Command     string
+
+    // Pre-argument and argument names.
+    Argument    string
+
+    // Flag names.
+    Flag        string
+
+    // Error messages.
+    Error       string
+}
+
+// The theme used by `UseColors` unless the program provides its own.
+var DefaultTheme = Theme{
+    Heading:    "1",
+    Command:    "36",
+    Argument:   "32",
+    Flag:       "33",
+    Error:      "31",
+}
+
+// The theme used for colored output, or nil if colors are disabled.
+var colorTheme *Theme = nil
+
+// Returns true if the usage is written to a terminal.
+var usageIsTerminal func() bool = func() bool {
+    f, isFile := usageOutput.(*os.File)
+    return isFile && isTerminal(int(f.Fd()))
+}
+
+// Enables colored usage and error output using the theme.  Colors are only used when the output
+// is a terminal and the NO_COLOR environment variable is not set.
+func UseColors(theme Theme) {
+    colorTheme = &theme
+}
+
+// Returns true if colored output is enabled and the usage is written to a terminal.  Colors are
+// never used when the NO_COLOR environment variable is set.
+func colorEnabled() bool {
+    return (colorTheme != nil) && (os.Getenv("NO_COLOR") == "") && usageIsTerminal()
+}
+
+// Returns the theme to style output with.  This is the empty theme if colors are disabled.
+func activeTheme() Theme {
+    if (!colorEnabled()) {
+        return Theme{}
+    }
+    return *colorTheme
+}
+
+// Returns the text wrapped in the escape sequences for the style.
+func colorize(style, text string) string {
+    if (style == "") || (text == "") {
+        return text
+    }
+    return "\x1b[" + style + "m" + text + "\x1b[0m"
+}
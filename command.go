@@ -18,10 +18,15 @@
 package command
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
     "sort"
 )
 
@@ -47,6 +52,13 @@ var reserveHFlag bool = true
 
 var helpPreargOverride bool = false
 
+// The name of the command run when no command name is given, or the empty string if there is
+// no default command.
+var defaultCmdName string = ""
+
+// Names of the global flags which are also accepted after the command name.
+var persistentFlagNames []string = make([]string, 0)
+
 // Cmd represents a sub command, allowing to define subcommand
 // flags and runnable to run once arguments match the subcommand
 // requirements.
@@ -63,12 +75,30 @@ type cmdCont struct {
 	command       Cmd
 	requiredFlags []string
     args          cmdArgs
+    long          string
+    examples      []cmdExample
+    interspersed  bool
+    shortFlags    map[string]string
+    secretFlags   map[string]bool
+    flagChoices   map[string][]string
+    passthrough   bool
+    dryRun        bool
+    flagGroups    []flagGroup
+}
+
+type cmdExample struct {
+    cmdline     string
+    explanation string
 }
 
 type preArgDef struct {
-    name    string
-    desc    string
-    val     string
+    name        string
+    desc        string
+    value       flag.Value
+    optional    bool
+    defValue    string
+    choices     []string
+    validate    func(value string) error
 }
 
 // A parse error.  This is returned from `TryParse()`
@@ -82,17 +112,108 @@ type TryParseError struct {
 
     // The error message string.
     Message     string
+
+    // The sentinel error describing the kind of error, such as `ErrTooFewArguments`.  This is
+    // returned by Unwrap so that errors.Is can be used to check for it.
+    Err         error
+
+    // The command line the error relates to, starting with the program name.  Argument files
+    // will have been expanded, unless the error is from expanding them.
+    Args        []string
+
+    // The index in Args of the offending argument.  If an argument is missing, this is the
+    // length of Args.  If the error does not relate to a single argument, this is -1.
+    Index       int
+
+    // A description of what was expected, such as the name of a missing argument.  This may be
+    // the empty string.
+    Expected    string
+
+    // The offending argument or value which was received.  This may be the empty string.
+    Received    string
+}
+
+// Sentinel errors identifying the kind of a `TryParseError`.
+var (
+    ErrMissingPreArg            =   errors.New("missing pre-argument")
+    ErrInvalidPreArg            =   errors.New("invalid pre-argument")
+    ErrMissingCommand           =   errors.New("missing command")
+    ErrInvalidCommand           =   errors.New("invalid command")
+    ErrInvalidFlag              =   errors.New("invalid flag")
+    ErrMissingRequiredFlags     =   errors.New("missing required flags")
+    ErrTooFewArguments          =   errors.New("too few arguments")
+    ErrTooManyArguments         =   errors.New("too many arguments")
+    ErrArgFile                  =   errors.New("invalid argument file")
+    ErrDryRunUnsupported        =   errors.New("dry-run not supported")
+    ErrMutuallyExclusiveFlags   =   errors.New("mutually exclusive flags")
+    ErrMissingFlagGroup         =   errors.New("missing one of a group of flags")
+    ErrFlagRequires             =   errors.New("flag requires other flags")
+)
+
+// Returns a parse error which does not relate to a single argument.
+func newParseError(reason TryParseReason, command string, err error, message string, argv []string) TryParseError {
+    return TryParseError{Reason: reason, Command: command, Message: message, Err: err, Args: argv, Index: -1}
+}
+
+// Returns a copy of the parse error relating to the argument at index.
+func (tp TryParseError) at(index int, expected, received string) TryParseError {
+    tp.Index = index
+    tp.Expected = expected
+    tp.Received = received
+    return tp
 }
 
 func (tp TryParseError) Error() string {
     return tp.Message
 }
 
+// Returns the sentinel error describing the kind of error.
+func (tp TryParseError) Unwrap() error {
+    return tp.Err
+}
+
+// Returns the command line with the offending argument marked on the line below it.  Returns
+// the empty string if the error does not relate to a single argument.
+func (tp TryParseError) Highlight() string {
+    if (tp.Index < 0) || (len(tp.Args) == 0) {
+        return ""
+    }
+
+    line := ""
+    markerStart, markerLen := 0, 1
+    for i, arg := range tp.Args {
+        if (i > 0) {
+            line += " "
+        }
+        quoted := quoteArg(arg)
+        if (i == tp.Index) {
+            markerStart, markerLen = utf8.RuneCountInString(line), utf8.RuneCountInString(quoted)
+        }
+        line += quoted
+    }
+    if (tp.Index >= len(tp.Args)) {
+        markerStart = utf8.RuneCountInString(line) + 1
+    }
+
+    return "  " + line + "\n  " + strings.Repeat(" ", markerStart) + strings.Repeat("^", markerLen)
+}
+
+// Quotes the argument if it is empty or contains whitespace or quotes.
+func quoteArg(arg string) string {
+    if (arg != "") && !strings.ContainsAny(arg, " \t\n'\"\\") {
+        return arg
+    }
+    return "'" + strings.Replace(arg, "'", "'\\''", -1) + "'"
+}
+
 // Displays an appropriate usage string depending on the error raised.  If the error relates to
 // a command, this displays the command usage string.  Otherwise, this will display the program
 // usage string.
 func (tp TryParseError) Usage() {
-    fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], tp.Message)
+    fmt.Fprintf(usageOutput, "%s: %s\n", os.Args[0], colorize(activeTheme().Error, tp.Message))
+    if highlight := tp.Highlight(); highlight != "" {
+        fmt.Fprintf(usageOutput, "%s\n\n", highlight)
+    }
     if tp.Command != "" {
         subcommandUsageByName(tp.Command)
     } else {
@@ -121,6 +242,18 @@ const (
     // Invalid argument usage.
     // Global flags and pre-arguments were parsed successfully.
     TryParseArgError                =   iota
+
+    // A pre-argument was encountered but its value was invalid.
+    // Global flags were parsed successfully.
+    TryParsePreArgError             =   iota
+
+    // Invalid flag usage, either in the global flags or the command flags.  If the error relates
+    // to the command flags, global flags and pre-arguments were parsed successfully.
+    TryParseFlagError               =   iota
+
+    // An argument file could not be read.
+    // Nothing was parsed.
+    TryParseArgFileError            =   iota
 )
 
 
@@ -137,7 +270,8 @@ type CmdBuilder struct {
 // The valid argument name formats are:
 //
 //      name    - A mandatory argument
-//      [name]  - An optional argument.  This is consumed greedily.
+//      [name]  - An optional argument.  This is consumed greedily, but not if the argument is
+//                needed by a mandatory argument following it.
 //      '...'   - Indicates that more arguments are possible.
 //      
 func (cb *CmdBuilder) Arguments(args ...string) *CmdBuilder {
@@ -151,6 +285,48 @@ func (cb *CmdBuilder) Arguments(args ...string) *CmdBuilder {
     return cb
 }
 
+// Marks the named command flags as required.  If any of them are not set, the command line
+// parsing will fail with a `TryParseInvalidCommand` reason.
+func (cb *CmdBuilder) RequiredFlags(names ...string) *CmdBuilder {
+    cb.cmd.requiredFlags = append(cb.cmd.requiredFlags, names...)
+    return cb
+}
+
+// Restricts the value of the named command flag to one of the passed in choices.  Any other
+// value will fail the command line parsing with a `TryParseFlagError` reason.
+func (cb *CmdBuilder) FlagChoices(name string, choices ...string) *CmdBuilder {
+    if (cb.cmd.flagChoices == nil) {
+        cb.cmd.flagChoices = make(map[string][]string)
+    }
+    cb.cmd.flagChoices[name] = choices
+    return cb
+}
+
+// Allows the command flags to appear anywhere after the command name, interspersed with the
+// command arguments.  Without this, flag processing stops at the first argument which is not a
+// flag.  An argument of "--" ends flag processing, with all remaining arguments treated as
+// command arguments.
+func (cb *CmdBuilder) Interspersed() *CmdBuilder {
+    cb.cmd.interspersed = true
+    return cb
+}
+
+// Sets the long description of the command.  This is displayed in place of the description
+// passed to `On` when showing the command usage, which is still used in the command listing.
+func (cb *CmdBuilder) Long(text string) *CmdBuilder {
+    cb.cmd.long = text
+    return cb
+}
+
+// Adds a worked example to the command usage.  The cmdline is the example invocation as it
+// would be typed after the program name, including any global flags, pre-arguments and the
+// command name itself.  The explanation is displayed below the example.  Examples can be
+// checked against the parser using `CheckExamples`.
+func (cb *CmdBuilder) Example(cmdline, explanation string) *CmdBuilder {
+    cb.cmd.examples = append(cb.cmd.examples, cmdExample{cmdline, explanation})
+    return cb
+}
+
 // Registers a Cmd for the provided sub-command name. E.g. name is the
 // `status` in `git status`.  Returns a CmdBuilder which can be used to further
 // configure the specific command.
@@ -172,7 +348,27 @@ func On(name, description string, command Cmd) *CmdBuilder {
 // When called, this frees up the '-h' flag for commands to use.
 func OnHelpShowUsage() {
     reserveHFlag = false
-    On("help", "Displays usage string of commands", cmdUsageCmd(subcommandUsageByName))
+    On("help", "Displays usage string of commands", cmdUsageCmd(subcommandUsageByName)).SupportsDryRun()
+}
+
+// Sets the command which is run when no command name is given.  If the argument where the
+// command name is expected is not the name of a command or plugin, the default command is run
+// with it as the first argument.  The default command is marked in the usage string.
+func SetDefault(name string) {
+    defaultCmdName = name
+}
+
+// Returns true if the default command should be run because the argument at commandNameArgN is
+// missing or is not a command name.
+func useDefaultCommand(globalFlags *flag.FlagSet, commandNameArgN int) bool {
+    if (defaultCmdName == "") {
+        return false
+    } else if (globalFlags.NArg() <= commandNameArgN) {
+        return true
+    }
+    name := globalFlags.Arg(commandNameArgN)
+    _, isCmd := cmds[name]
+    return !isCmd && (findPlugin(name) == "")
 }
 
 // When called, will ignore all preargs if the first argument is "help".  Useful for avoiding
@@ -182,12 +378,92 @@ func OnHelpIgnorePreargs() {
     helpPreargOverride = true
 }
 
+// Marks the named global flags as persistent.  Persistent flags are registered once as global
+// flags using the flag package, but are accepted both before and after the command name.  If a
+// command defines a flag with the same name, the command flag takes precedence after the
+// command name.  Names which do not refer to a global flag are ignored.
+func PersistentFlags(names ...string) {
+    persistentFlagNames = append(persistentFlagNames, names...)
+}
+
 // Registers a PreArg.  This is an argument which is read before the command.
 // Returns a string pointer which will be set after calling Parse.
 func PreArg(name, description string) *string {
-    newPreArgDef := &preArgDef{name, description, ""}
+    p := new(string)
+    PreArgStringVar(p, name, description)
+    return p
+}
+
+// Registers a string PreArg which will be stored in the passed in string pointer.  Returns
+// a PreArgBuilder which can be used to further configure the pre-argument.
+func PreArgStringVar(p *string, name, description string) *PreArgBuilder {
+    return PreArgVar((*stringValue)(p), name, description)
+}
+
+// Registers an integer PreArg which will be stored in the passed in int pointer.  Values which
+// are not integers will fail the command line parsing with a `TryParsePreArgError` reason.
+func PreArgIntVar(p *int, name, description string) *PreArgBuilder {
+    return PreArgVar((*intValue)(p), name, description)
+}
+
+// Registers a PreArg which will only accept one of the passed in choices.  Any other value
+// will fail the command line parsing with a `TryParsePreArgError` reason.
+func PreArgEnumVar(p *string, name, description string, choices ...string) *PreArgBuilder {
+    pb := PreArgStringVar(p, name, description)
+    pb.def.choices = choices
+    return pb.Validate(func(value string) error {
+        for _, choice := range choices {
+            if value == choice {
+                return nil
+            }
+        }
+        return errors.New(message("must be one of: %s", strings.Join(choices, ", ")))
+    })
+}
+
+// Registers a PreArg with a custom flag.Value.  The value's `Set` method is called with the
+// pre-argument once it is read, and any error it returns will fail the command line parsing
+// with a `TryParsePreArgError` reason.
+func PreArgVar(value flag.Value, name, description string) *PreArgBuilder {
+    newPreArgDef := &preArgDef{name: name, desc: description, value: value}
     preargdefs = append(preargdefs, newPreArgDef)
-    return &(newPreArgDef.val)
+    return &PreArgBuilder{newPreArgDef}
+}
+
+// Provides configuration operations for PreArgs.
+type PreArgBuilder struct {
+    def         *preArgDef
+}
+
+// Makes the pre-argument optional, setting it to the passed in default value if it is not
+// present.  Only trailing pre-arguments can be optional: once an optional pre-argument is
+// registered, all subsequent pre-arguments must be optional as well.  Optional pre-arguments
+// are consumed until the command name is encountered.
+func (pb *PreArgBuilder) Default(value string) *PreArgBuilder {
+    pb.def.optional = true
+    pb.def.defValue = value
+    pb.def.value.Set(value)
+    checkPreArgOrder()
+    return pb
+}
+
+// Panics if a mandatory pre-argument is registered after an optional pre-argument.  This is
+// checked once the pre-argument is made optional and again when parsing, as a pre-argument is
+// only made optional after it is registered.
+func checkPreArgOrder() {
+    for i := 1; i < len(preargdefs); i++ {
+        if (preargdefs[i - 1].optional) && (!preargdefs[i].optional) {
+            panic("command: mandatory pre-argument " + preargdefs[i].name + " registered after an optional pre-argument")
+        }
+    }
+}
+
+// Adds a validation function to the pre-argument.  The function is called with the
+// pre-argument before it is set, and any error it returns will fail the command line parsing
+// with a `TryParsePreArgError` reason.
+func (pb *PreArgBuilder) Validate(fn func(value string) error) *PreArgBuilder {
+    pb.def.validate = fn
+    return pb
 }
 
 // Prints the usage.
@@ -195,8 +471,8 @@ func Usage() {
 	program := os.Args[0]
 	if len(cmds) == 0 {
 		// no subcommands
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", program)
-		flag.PrintDefaults()
+		printUsageHeading(message("Usage of %s:", program))
+		printFlagDefaults(flag.CommandLine, globalShortFlags)
 		return
 	}
 
@@ -206,25 +482,53 @@ func Usage() {
     }
     sort.Strings(names)
 
-	//fmt.Fprintf(os.Stderr, "Usage: %s <command>\n\n", program)
-	fmt.Fprintf(os.Stderr, "Usage: %s", program)
+    theme := activeTheme()
+
+	//fmt.Fprintf(usageOutput, "Usage: %s <command>\n\n", program)
+	fmt.Fprintf(usageOutput, "%s %s", colorize(theme.Heading, message("Usage:")), program)
     for _, preargdef := range preargdefs {
-        fmt.Fprintf(os.Stderr, " <%s>", preargdef.name)
+        fmt.Fprintf(usageOutput, " %s", colorize(theme.Argument, preargdef.usageName()))
+    }
+	fmt.Fprintf(usageOutput, " %s\n\n", colorize(theme.Command, "<command>"))
+
+    if len(preargdefs) > 0 {
+        printUsageHeading(message("where the pre-arguments are:"))
+        rows := make([]usageRow, 0, len(preargdefs))
+        for _, preargdef := range preargdefs {
+            rows = append(rows, usageRow{preargdef.name, preargdef.usageDesc()})
+        }
+        printUsageTable(rows, theme.Argument)
+        fmt.Fprintf(usageOutput, "\n")
     }
-	fmt.Fprintf(os.Stderr, " <command>\n\n")
 
-	fmt.Fprintf(os.Stderr, "where <command> is one of:\n")
+	printUsageHeading(message("where <command> is one of:"))
+    rows := make([]usageRow, 0, len(names))
 	for _, name := range names {
-        cont := cmds[name]
-		fmt.Fprintf(os.Stderr, "  %-15s %s\n", name, cont.desc)
+        desc := message(cmds[name].desc)
+        if (name == defaultCmdName) {
+            desc += " (" + message("default") + ")"
+        }
+        rows = append(rows, usageRow{name, desc})
 	}
+    printUsageTable(rows, theme.Command)
+
+    if (pluginsEnabled) {
+        if plugins := discoverPlugins(); len(plugins) > 0 {
+            fmt.Fprintf(usageOutput, "\n")
+            printUsageHeading(message("available plugins:"))
+            for _, plugin := range plugins {
+                fmt.Fprintf(usageOutput, "  %s\n", colorize(theme.Command, plugin))
+            }
+        }
+    }
 
 	if numOfGlobalFlags() > 0 {
-		fmt.Fprintf(os.Stderr, "\navailable flags:\n")
-		flag.PrintDefaults()
+		fmt.Fprintf(usageOutput, "\n")
+		printUsageHeading(message("available flags:"))
+		printFlagDefaults(flag.CommandLine, globalShortFlags)
 	}
     if (reserveHFlag) {
-        fmt.Fprintf(os.Stderr, "\n%s <command> -h for subcommand help\n", program)
+        fmt.Fprintf(usageOutput, "\n%s\n", message("%s <command> -h for subcommand help", program))
     }
 }
 
@@ -233,36 +537,80 @@ func subcommandUsageByName(cmdName string) {
     if hasCont {
         subcommandUsage(cont)
     } else {
-        fmt.Fprintf(os.Stderr, "unreognised command: %s\n", cmdName)
+        fmt.Fprintf(usageOutput, "%s\n", message("unrecognised command: %s", cmdName))
         Usage()
         os.Exit(1)
     }
 }
 
 func subcommandUsage(cont *cmdCont) {
-	fmt.Fprintf(os.Stderr, "%s\n\n", cont.desc)
+    if (cont.long != "") {
+        printUsageText(message(cont.long), 0)
+    } else {
+        printUsageText(message(cont.desc), 0)
+    }
+    fmt.Fprintln(usageOutput)
 
 	fs := cont.command.Flags(flag.NewFlagSet(cont.name, flag.ContinueOnError))
 
-	fmt.Fprintf(os.Stderr, "Usage: %s %s", os.Args[0], cont.name)
+    theme := activeTheme()
+	fmt.Fprintf(usageOutput, "%s %s %s", colorize(theme.Heading, message("Usage:")), os.Args[0], colorize(theme.Command, cont.name))
     if (cont.args != nil) {
         for _, arg := range cont.args {
-            fmt.Fprintf(os.Stderr, " %s", arg.name)
+            fmt.Fprintf(usageOutput, " %s", colorize(theme.Argument, arg.name))
         }
     }
-	fmt.Fprintf(os.Stderr, "\n\n")
+	fmt.Fprintf(usageOutput, "\n\n")
 
     flagCount := 0
     fs.VisitAll(func(_ *flag.Flag) { flagCount++ })
 
     if (flagCount > 0) {
-        fmt.Fprintf(os.Stderr, "Available flags:\n")
-        fs.PrintDefaults()
+        printUsageHeading(message("Available flags:"))
+        printFlagDefaults(fs, cont.shortFlags)
+        if (len(cont.flagGroups) > 0) {
+            fmt.Fprintf(usageOutput, "\n")
+            printUsageHeading(message("Flag constraints:"))
+            for _, fg := range cont.flagGroups {
+                fmt.Fprintf(usageOutput, "  %s\n", fg)
+            }
+        }
 	    if len(cont.requiredFlags) > 0 {
-		    fmt.Fprintf(os.Stderr, "\nRequired flags:\n")
-            fmt.Fprintf(os.Stderr, "  %s\n\n", strings.Join(cont.requiredFlags, ", "))
+		    fmt.Fprintf(usageOutput, "\n")
+		    printUsageHeading(message("Required flags:"))
+            requiredFlags := make([]string, 0, len(cont.requiredFlags))
+            for _, name := range cont.requiredFlags {
+                requiredFlags = append(requiredFlags, colorize(theme.Flag, name))
+            }
+            fmt.Fprintf(usageOutput, "  %s\n\n", strings.Join(requiredFlags, ", "))
 	    }
     }
+
+    inheritedFlags := flag.NewFlagSet(cont.name, flag.ContinueOnError)
+    addPersistentFlags(flag.CommandLine, fs, inheritedFlags)
+    inheritedCount := 0
+    inheritedFlags.VisitAll(func(_ *flag.Flag) { inheritedCount++ })
+
+    if (inheritedCount > 0) {
+        if (flagCount > 0) {
+            fmt.Fprintf(usageOutput, "\n")
+        }
+        printUsageHeading(message("Inherited flags:"))
+        printFlagDefaults(inheritedFlags, globalShortFlags)
+    }
+
+    if (len(cont.examples) > 0) {
+        if (flagCount > 0) || (inheritedCount > 0) {
+            fmt.Fprintf(usageOutput, "\n")
+        }
+        printUsageHeading(message("Examples:"))
+        for _, example := range cont.examples {
+            fmt.Fprintf(usageOutput, "  %s %s\n", os.Args[0], example.cmdline)
+            if (example.explanation != "") {
+                printUsageText(message(example.explanation), 6)
+            }
+        }
+    }
 }
 
 // Clear pre-args
@@ -287,12 +635,64 @@ func Parse() {
 }
 
 // Like Parse() but will return an error if there was a problem parsing the flag without
-// displaying the usage and exiting.
+// displaying the usage and exiting.  If the first argument is the hidden flag --help-json,
+// `Run` will print the description returned by `Describe` as JSON instead of running a command.
 func TryParse() error {
+    if (len(os.Args) > 1) && (os.Args[1] == helpJSONArg) {
+        matchingCmd = &cmdCont{name: helpJSONArg, command: describeCmd{}}
+        args = os.Args[2:]
+        flagHelp = nil
+        return nil
+    }
+
+    start := time.Now()
+    err := tryParseArgs(flag.CommandLine, os.Args[1:])
+    recordSpan("parse", start, matchingCmd, os.Args[1:], err)
+    if err != nil {
+        writeTrace()
+    }
+    return err
+}
+
+// Parses the arguments against the global flag set and the registered commands.  The
+// arguments are expected to exclude the program name.
+func tryParseArgs(globalFlags *flag.FlagSet, arguments []string) error {
+    parsedLinks = nil
     var expectedArgCount int = 1
     var commandNameArgN int = 0
 
-	flag.Parse()
+    if (argFilesEnabled) {
+        expanded, index, err := expandArgFiles(arguments, 0)
+        if err != nil {
+            return newParseError(TryParseArgFileError, "", ErrArgFile, err.Error(), append([]string{os.Args[0]}, arguments...)).
+                at(index + 1, "", arguments[index])
+        }
+        arguments = expanded
+    }
+
+    // The command line used to report errors.  Translating POSIX flags leaves the arguments
+    // following the flags untouched, so the positions of the arguments remaining after
+    // parsing the flags are the same as their positions here.
+    argv := append([]string{os.Args[0]}, arguments...)
+
+    if (posixFlags) {
+        arguments = translatePosixArgs(globalFlags, globalShortFlags, arguments, false)
+    }
+	if err := globalFlags.Parse(arguments); err != nil {
+        parseErr := newParseError(TryParseFlagError, "", ErrInvalidFlag, err.Error(), argv)
+        if (!posixFlags) {
+            index := len(argv) - globalFlags.NArg() - 1
+            parseErr = parseErr.at(index, "", argv[index])
+        }
+        return parseErr
+    }
+    argBase := len(argv) - globalFlags.NArg()
+    if versionRequested(globalFlags) {
+        matchingCmd = &cmdCont{name: "version", command: &versionCmd{}}
+        args = globalFlags.Args()
+        flagHelp = nil
+        return nil
+    }
 	// if there are no subcommands registered,
 	// return immediately
 	if len(cmds) < 1 {
@@ -301,34 +701,102 @@ func TryParse() error {
 
 
     // Read and set the preargs
-    consumePreargs := (helpPreargOverride && !((flag.NArg() > 0) && (flag.Arg(0) == "help"))) || !helpPreargOverride
+    consumePreargs := (helpPreargOverride && !((globalFlags.NArg() > 0) && (globalFlags.Arg(0) == "help"))) || !helpPreargOverride
 
     if consumePreargs {
-        commandNameArgN = len(preargdefs)
-        expectedArgCount = commandNameArgN + 1
-        if flag.NArg() < expectedArgCount - 1 {
-            return TryParseError{TryParseNoPreArg, "", fmt.Sprintf("expected %d argument(s) before command", expectedArgCount - 1)}
-        }
+        checkPreArgOrder()
+        for _, preargdef := range preargdefs {
+            if (preargdef.optional) {
+                // Stop at the command name, or if there would be nothing left for the command
+                _, isCmd := cmds[globalFlags.Arg(commandNameArgN)]
+                if (globalFlags.NArg() - commandNameArgN <= 1) || isCmd {
+                    preargdef.value.Set(preargdef.defValue)
+                    continue
+                }
+            } else if (globalFlags.NArg() <= commandNameArgN) {
+                if canPrompt() && (promptPreArg(preargdef) == nil) {
+                    continue
+                }
+                return newParseError(TryParseNoPreArg, "", ErrMissingPreArg, message("expected %d argument(s) before command: missing <%s>", numOfMandatoryPreArgs(), preargdef.name), argv).
+                    at(len(argv), "<" + preargdef.name + ">", "")
+            }
 
-        for i, preargdef := range preargdefs {
-            preargdef.val = flag.Arg(i)
+            if err := preargdef.set(globalFlags.Arg(commandNameArgN)); err != nil {
+                return newParseError(TryParsePreArgError, "", ErrInvalidPreArg, err.Error(), argv).
+                    at(argBase + commandNameArgN, preargdef.usageDesc(), globalFlags.Arg(commandNameArgN))
+            }
+            commandNameArgN++
         }
+        expectedArgCount = commandNameArgN + 1
     }
 
     // Read and set the commands
-	if flag.NArg() < expectedArgCount {
-        return TryParseError{TryParseNoCommand, "", "missing command"}
+    cmdIndex := argBase + commandNameArgN
+    if useDefaultCommand(globalFlags, commandNameArgN) {
+        // Insert the name of the default command so that the remaining arguments are passed to it
+        argv = append(append(argv[:cmdIndex:cmdIndex], defaultCmdName), argv[cmdIndex:]...)
+    } else if globalFlags.NArg() < expectedArgCount {
+        return newParseError(TryParseNoCommand, "", ErrMissingCommand, message("missing command"), argv).at(len(argv), "<command>", "")
     }
 
-	name := flag.Arg(commandNameArgN)
-	if cont, ok := cmds[name]; ok {
-		fs := cont.command.Flags(flag.NewFlagSet(name, flag.ExitOnError))
+    return parseChain(globalFlags, argv, cmdIndex)
+}
+
+// Parses the command name at cmdIndex in argv and the arguments following it, setting the
+// matching command.  The global flags are used for looking up the persistent flags.
+func parseCommand(globalFlags *flag.FlagSet, argv []string, cmdIndex int) error {
+    name := argv[cmdIndex]
+    cmdArguments := argv[cmdIndex + 1:]
+
+	if cont, ok := cmds[name]; ok && cont.passthrough {
+        // Pass all the arguments through without parsing them as flags
+        matchingCmd = cont
+        args = cmdArguments
+        flagHelp = nil
+        if err := checkDryRun(globalFlags, cont, argv, cmdIndex); err != nil {
+            return err
+        }
+        if (cont.args != nil) {
+            if err := cont.args.Validate(args); err != nil {
+                return argParseError(name, err, argv, args)
+            }
+        }
+        return nil
+	} else if ok {
+		fs := cont.command.Flags(flag.NewFlagSet(name, flag.ContinueOnError))
+        fs.SetOutput(ioutil.Discard)
         if (reserveHFlag) {
             flagHelp = fs.Bool("h", false, "")
         }
-		fs.Parse(flag.Args()[commandNameArgN + 1:])
-		args = fs.Args()
+        addPersistentFlags(globalFlags, fs, fs)
+        var err error
+        if (posixFlags) {
+            cmdArguments = translatePosixArgs(fs, cmdShortFlags(cont, fs), cmdArguments, cont.interspersed)
+        }
+        if (cont.interspersed) {
+            args, err = parseInterspersed(fs, cmdArguments)
+        } else {
+            err = fs.Parse(cmdArguments)
+            args = fs.Args()
+        }
+        if (err == flag.ErrHelp) {
+            // The -h flag is not reserved, so show the command usage in place of running it
+            showHelp := true
+            matchingCmd, args, flagHelp = cont, nil, &showHelp
+            return nil
+        }
+		if err != nil {
+            parseErr := newParseError(TryParseFlagError, name, ErrInvalidFlag, name + ": " + err.Error(), argv)
+            if (!posixFlags) {
+                index := len(argv) - fs.NArg() - 1
+                parseErr = parseErr.at(index, "", argv[index])
+            }
+            return parseErr
+        }
 		matchingCmd = cont
+        if err := checkDryRun(globalFlags, cont, argv, cmdIndex); err != nil {
+            return err
+        }
 
 		// Check for required flags.
 		flagMap := make(map[string]bool)
@@ -338,33 +806,177 @@ func TryParse() error {
 		fs.Visit(func(f *flag.Flag) {
 			delete(flagMap, f.Name)
 		})
+        if (len(flagMap) > 0) && canPrompt() {
+            for _, flagName := range cont.requiredFlags {
+                if (flagMap[flagName]) && (promptFlag(cont, fs, flagName) == nil) {
+                    delete(flagMap, flagName)
+                }
+            }
+        }
 		if len(flagMap) > 0 {
-			return TryParseError{TryParseInvalidCommand, name, name + ": missing required flags"}
+            missingFlags := make([]string, 0, len(flagMap))
+            for _, flagName := range cont.requiredFlags {
+                if (flagMap[flagName]) {
+                    missingFlags = append(missingFlags, "-" + flagName)
+                }
+            }
+			return newParseError(TryParseInvalidCommand, name, ErrMissingRequiredFlags, name + ": " + message("missing required flags: %s", strings.Join(missingFlags, ", ")), argv).
+                at(-1, strings.Join(missingFlags, ", "), "")
 		}
 
+        if err := checkFlagGroups(cont, fs, argv); err != nil {
+            return err
+        }
+
+        // Check the flag choices
+        var choiceErr error
+        fs.Visit(func(f *flag.Flag) {
+            if choices, hasChoices := cont.flagChoices[f.Name]; hasChoices && (choiceErr == nil) {
+                for _, choice := range choices {
+                    if (f.Value.String() == choice) {
+                        return
+                    }
+                }
+                expected := message("one of: %s", strings.Join(choices, ", "))
+                choiceMessage := name + ": " + message("invalid value %q for flag -%s: must be %s", f.Value.String(), f.Name, expected)
+                choiceErr = newParseError(TryParseFlagError, name, ErrInvalidFlag, choiceMessage, argv).at(-1, expected, f.Value.String())
+            }
+        })
+        if (choiceErr != nil) {
+            return choiceErr
+        }
+
         // Validate the arguments
         if (cont.args != nil) {
             err := cont.args.Validate(args)
+            if (err != nil) && (len(cont.args.missing(args)) > 0) && canPrompt() {
+                if promptedArgs, promptErr := promptArgs(cont.args, args); promptErr == nil {
+                    args = promptedArgs
+                    err = cont.args.Validate(args)
+                }
+            }
             if err != nil {
-                return TryParseError{TryParseArgError, name, name + ": " + err.Error()}
+                return argParseError(name, err, argv, args)
             }
         }
 
 		return nil
+	} else if pluginPath := findPlugin(name); pluginPath != "" {
+        matchingCmd = &cmdCont{name: name, desc: "plugin " + pluginPath, command: pluginCmd(pluginPath)}
+        args = cmdArguments
+        flagHelp = nil
+        return checkDryRun(globalFlags, matchingCmd, argv, cmdIndex)
 	} else {
-        return TryParseError{TryParseInvalidCommand, "", "invalid command: " + name}
+        return newParseError(TryParseInvalidCommand, "", ErrInvalidCommand, message("invalid command: %s", name), argv).at(cmdIndex, "<command>", name)
 	}
 }
 
+// Returns the parse error for an error returned from validating the command arguments cmdArgs.
+// The arguments are assumed to be at the end of argv.
+func argParseError(name string, err error, argv []string, cmdArgs []string) TryParseError {
+    argErr := err.(argError)
+    parseErr := newParseError(TryParseArgError, name, argErr.err, name + ": " + err.Error(), argv)
+
+    // Locate the argument by matching the arguments from the end of the command line, as they
+    // may be interspersed with flags
+    index := len(argv)
+    if (argErr.position < len(cmdArgs)) {
+        index = len(argv) - (len(cmdArgs) - argErr.position)
+        for i, j := len(argv) - 1, len(cmdArgs) - 1; i >= 0; i-- {
+            if (argv[i] == cmdArgs[j]) {
+                if (j == argErr.position) {
+                    index = i
+                    break
+                }
+                j--
+            }
+        }
+    }
+    return parseErr.at(index, argErr.expected, argErr.received)
+}
+
+// Checks that the examples of all the registered commands are accepted by the parser.  This
+// is intended to be called from tests so that examples do not go stale.  The state set by
+// a previous call to `Parse` or `TryParse`, including the values of the global flags, is
+// restored once the examples are checked.  Returns the first example which fails to parse.
+func CheckExamples() error {
+    names := make([]string, 0, len(cmds))
+    for name := range cmds {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    for _, name := range names {
+        for _, example := range cmds[name].examples {
+            if err := checkExample(example); err != nil {
+                return fmt.Errorf("%s: example '%s': %v", name, example.cmdline, err)
+            }
+        }
+    }
+    return nil
+}
+
+// Parses a single example, restoring the parser state afterwards.
+func checkExample(example cmdExample) error {
+    savedMatchingCmd, savedArgs, savedFlagHelp, savedPromptMissing := matchingCmd, args, flagHelp, promptMissing
+    savedChain, savedLinks := chain, parsedLinks
+    promptMissing = false
+    savedPreargs := make([]string, len(preargdefs))
+    for i, preargdef := range preargdefs {
+        savedPreargs[i] = preargdef.value.String()
+    }
+
+    // Use a copy of the global flag set so that parse errors do not exit the program
+    globalFlags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+    globalFlags.SetOutput(ioutil.Discard)
+    savedFlagVals := make(map[string]string)
+    flag.VisitAll(func(f *flag.Flag) {
+        globalFlags.Var(f.Value, f.Name, f.Usage)
+        savedFlagVals[f.Name] = f.Value.String()
+    })
+
+    defer func() {
+        // Parse the matched commands again, as parsing the example binds their flags to its values
+        for _, link := range savedLinks {
+            parseCommand(flag.CommandLine, link.argv, link.cmdIndex)
+        }
+        matchingCmd, args, flagHelp, promptMissing = savedMatchingCmd, savedArgs, savedFlagHelp, savedPromptMissing
+        chain, parsedLinks = savedChain, savedLinks
+        for i, preargdef := range preargdefs {
+            preargdef.value.Set(savedPreargs[i])
+        }
+        flag.VisitAll(func(f *flag.Flag) {
+            f.Value.Set(savedFlagVals[f.Name])
+        })
+    }()
+
+    exampleArgs, err := splitCommandLine(example.cmdline)
+    if err != nil {
+        return err
+    }
+    return tryParseArgs(globalFlags, exampleArgs)
+}
+
 // Runs the subcommand's runnable. If there is no subcommand
 // registered, it silently returns.
 func Run() {
+    if (len(chain) > 1) {
+        runChain()
+        return
+    }
+    runMatchingCmd()
+}
+
+// Runs the matching command, or displays its usage if -h was given.
+func runMatchingCmd() {
 	if matchingCmd != nil {
 		if (flagHelp != nil) && (*flagHelp) {
 			subcommandUsage(matchingCmd)
 			return
 		}
-		matchingCmd.command.Run(args)
+        run := startRun(matchingCmd, args)
+        defer finishRun(run)
+		runCommand(matchingCmd, args)
 	}
 }
 
@@ -374,6 +986,59 @@ func ParseAndRun() {
 	Run()
 }
 
+// Parses the flags in arguments, allowing them to be interspersed with non-flag arguments.
+// Returns the non-flag arguments.
+func parseInterspersed(fs *flag.FlagSet, arguments []string) ([]string, error) {
+    positionals := make([]string, 0)
+    for {
+        if err := fs.Parse(arguments); err != nil {
+            return nil, err
+        }
+
+        // Stop if flag parsing was terminated by "--"
+        if endsWithTerminator(fs, arguments[:len(arguments) - fs.NArg()]) {
+            return append(positionals, fs.Args()...), nil
+        }
+
+        if (fs.NArg() == 0) {
+            return positionals, nil
+        }
+        positionals = append(positionals, fs.Arg(0))
+        arguments = fs.Args()[1:]
+    }
+}
+
+// Returns true if the flags consumed by parsing the flag set end with the "--" terminator, as
+// opposed to "--" being the value of the last flag.
+func endsWithTerminator(fs *flag.FlagSet, consumed []string) bool {
+    for i := 0; i < len(consumed); i++ {
+        if (consumed[i] == "--") {
+            return true
+        }
+        name := strings.TrimPrefix(strings.TrimPrefix(consumed[i], "-"), "-")
+        if strings.Contains(name, "=") {
+            continue
+        }
+        if f := fs.Lookup(name); (f != nil) && !isBoolFlag(f) {
+            // Skip the value of the flag
+            i++
+        }
+    }
+    return false
+}
+
+// Adds the persistent flags defined in globalFlags to target, skipping any which are already
+// defined in cmdFlags.
+func addPersistentFlags(globalFlags, cmdFlags, target *flag.FlagSet) {
+    for _, name := range persistentFlagNames {
+        f := globalFlags.Lookup(name)
+        if (f == nil) || (cmdFlags.Lookup(name) != nil) || (target.Lookup(name) != nil) {
+            continue
+        }
+        target.Var(f.Value, f.Name, f.Usage)
+    }
+}
+
 // Returns the total number of globally registered flags.
 func numOfGlobalFlags() (count int) {
 	flag.VisitAll(func(flag *flag.Flag) {
@@ -430,30 +1095,164 @@ func cmdArgFromString(argPattern string) cmdArg {
 // A collection of cmd arguments
 type cmdArgs    []cmdArg
 
-// Validates the parsed command line arguments.
+// An error validating the command line arguments.
+type argError struct {
+    err         error
+    position    int
+    expected    string
+    received    string
+}
+
+func (ae argError) Error() string {
+    if (ae.err == ErrTooFewArguments) {
+        return message("too few arguments: missing %s", ae.expected)
+    } else {
+        return message("too many arguments: unexpected %s", quoteArg(ae.received))
+    }
+}
+
+// Validates the parsed command line arguments.  Returns an argError describing the position of
+// the missing or unexpected argument.
 func (ca cmdArgs) Validate(args []string) error {
-    for _, a := range ca {
+    position := 0
+    for i, a := range ca {
         switch a.argType {
         case atMandatory:
-            if len(args) == 0 {
-                return fmt.Errorf("too few arguments")
+            if (position >= len(args)) {
+                return argError{ErrTooFewArguments, position, a.name, ""}
             }
             // 'consume' the argument
-            args = args[1:]
+            position++
         case atOptional:
-            // Only 'consume' the argument if there are some arguments remaining
-            if len(args) > 0 {
-                args = args[1:]
+            // Only 'consume' the argument if there are arguments remaining for the mandatory
+            // arguments following it
+            if (len(args) - position > ca.mandatoryAfter(i)) {
+                position++
             }
         case atEllipse:
-            // Consume the remaining arguments
-            args = args[0:0]
+            // Consume the remaining arguments, except those for the mandatory arguments
+            // following it
+            if (len(args) - ca.mandatoryAfter(i) > position) {
+                position = len(args) - ca.mandatoryAfter(i)
+            }
         }
     }
 
-    if (len(args) != 0) {
-        return fmt.Errorf("too many arguments")
+    if (position < len(args)) {
+        return argError{ErrTooManyArguments, position, "", args[position]}
     } else {
         return nil
     }
 }
+
+// Returns the mandatory arguments which are missing from the parsed command line arguments.
+func (ca cmdArgs) missing(args []string) []cmdArg {
+    missing := make([]cmdArg, 0)
+    remaining := len(args)
+    for i, a := range ca {
+        switch a.argType {
+        case atMandatory:
+            if (remaining == 0) {
+                missing = append(missing, a)
+            } else {
+                remaining--
+            }
+        case atOptional:
+            if (remaining > ca.mandatoryAfter(i)) {
+                remaining--
+            }
+        case atEllipse:
+            if (remaining > ca.mandatoryAfter(i)) {
+                remaining = ca.mandatoryAfter(i)
+            }
+        }
+    }
+    return missing
+}
+
+// Returns the number of mandatory arguments following the argument at index i.
+func (ca cmdArgs) mandatoryAfter(i int) int {
+    count := 0
+    for _, a := range ca[i + 1:] {
+        if (a.argType == atMandatory) {
+            count++
+        }
+    }
+    return count
+}
+
+// -----------------------------------------------------------------
+// Pre-arguments
+
+// Returns the name of the pre-argument as it appears in the usage string
+func (pa *preArgDef) usageName() string {
+    if (pa.optional) {
+        return "[" + pa.name + "]"
+    } else {
+        return "<" + pa.name + ">"
+    }
+}
+
+// Returns the description of the pre-argument as it appears in the usage string
+func (pa *preArgDef) usageDesc() string {
+    desc := message(pa.desc)
+    if (len(pa.choices) > 0) {
+        desc += " (" + message("one of: %s", strings.Join(pa.choices, ", ")) + ")"
+    }
+    if (pa.optional) && (pa.defValue != "") {
+        desc += " (" + message("default %q", pa.defValue) + ")"
+    }
+    return desc
+}
+
+// Validates and sets the value of the pre-argument.
+func (pa *preArgDef) set(val string) error {
+    if (pa.validate != nil) {
+        if err := pa.validate(val); err != nil {
+            return errors.New(message("invalid value %q for <%s>: %v", val, pa.name, err))
+        }
+    }
+    if err := pa.value.Set(val); err != nil {
+        return errors.New(message("invalid value %q for <%s>: %v", val, pa.name, err))
+    }
+    return nil
+}
+
+// Returns the number of pre-arguments which are not optional.
+func numOfMandatoryPreArgs() (count int) {
+    for _, preargdef := range preargdefs {
+        if (!preargdef.optional) {
+            count++
+        }
+    }
+    return
+}
+
+// A string pre-argument value
+type stringValue    string
+
+func (s *stringValue) Set(val string) error {
+    *s = stringValue(val)
+    return nil
+}
+
+func (s *stringValue) String() string {
+    return string(*s)
+}
+
+// An integer pre-argument value
+type intValue       int
+
+func (i *intValue) Set(val string) error {
+    v, err := strconv.Atoi(val)
+    if err != nil {
+        return errors.New(message("not an integer"))
+    }
+    *i = intValue(v)
+    return nil
+}
+
+func (i *intValue) String() string {
+    return strconv.Itoa(int(*i))
+}
+
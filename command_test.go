@@ -15,8 +15,11 @@
 package command
 
 import (
+	"errors"
 	"flag"
 	"os"
+	"runtime/debug"
+	"strings"
 	"testing"
 )
 
@@ -53,7 +56,7 @@ func TestGlobalFlagsCount(t *testing.T) {
 
 	total := numOfGlobalFlags()
 	if total != 2 {
-		t.Error("total number of global flags are expected to be 2, found %v", total)
+		t.Errorf("total number of global flags are expected to be 2, found %v", total)
 	}
 }
 
@@ -243,6 +246,260 @@ func TestTryParseWithHelpPreargOverride(t *testing.T) {
 	}
 }
 
+// Tests typed pre-args
+func TestTypedPreargs(t *testing.T) {
+	resetForTesting("8080", "prod", "command1")
+
+	var port int
+	var env string
+	PreArgIntVar(&port, "port", "the port")
+	PreArgEnumVar(&env, "env", "the environment", "dev", "prod")
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if port != 8080 {
+		t.Errorf("port expected to be 8080, was %d", port)
+	}
+	if env != "prod" {
+		t.Errorf("env expected to be 'prod', was %s", env)
+	}
+}
+
+// Tests typed pre-args with invalid values
+func TestTypedPreargsInvalid(t *testing.T) {
+	for _, testArgs := range [][]string{{"abc", "prod", "command1"}, {"8080", "test", "command1"}} {
+		resetForTesting(testArgs...)
+
+		var port int
+		var env string
+		PreArgIntVar(&port, "port", "the port")
+		PreArgEnumVar(&env, "env", "the environment", "dev", "prod")
+		On("command1", "", &testCmd1{})
+		res := TryParse()
+		if res == nil || res.(TryParseError).Reason != TryParsePreArgError {
+			t.Error("Try parse must be TryParsePreArgError, was", res)
+		}
+	}
+}
+
+// Tests pre-args with validation functions
+func TestValidatedPreargs(t *testing.T) {
+	resetForTesting("bad", "command1")
+
+	var pa string
+	PreArgStringVar(&pa, "pa", "this is a prearg").Validate(func(value string) error {
+		if value == "bad" {
+			return errors.New("bad value")
+		}
+		return nil
+	})
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParsePreArgError {
+		t.Error("Try parse must be TryParsePreArgError, was", res)
+	}
+	if !strings.Contains(res.Error(), "<pa>") {
+		t.Error("error must name the pre-arg, was", res)
+	}
+}
+
+// Tests optional pre-args
+func TestOptionalPreargs(t *testing.T) {
+	for _, test := range []struct {
+		args     []string
+		pa1, pa2 string
+	}{
+		{[]string{"a", "command1"}, "a", "default"},
+		{[]string{"a", "b", "command1"}, "a", "b"},
+		{[]string{"a", "command1", "command1"}, "a", "default"},
+	} {
+		resetForTesting(test.args...)
+
+		pa1 := PreArg("pa1", "this is a prearg")
+		var pa2 string
+		PreArgStringVar(&pa2, "pa2", "this is an optional prearg").Default("default")
+		c1 := &testCmd1{}
+		On("command1", "", c1)
+		res := TryParse()
+		if res != nil {
+			t.Error("Try parse must be OK, was", res)
+		}
+		if *pa1 != test.pa1 || pa2 != test.pa2 {
+			t.Errorf("%v: preargs expected to be %s %s, was %s %s", test.args, test.pa1, test.pa2, *pa1, pa2)
+		}
+	}
+}
+
+// Tests registering more than one trailing optional pre-arg
+func TestOptionalPreargsTrailing(t *testing.T) {
+	resetForTesting("a", "command1")
+
+	var pa1, pa2 string
+	PreArgStringVar(&pa1, "pa1", "").Default("x")
+	PreArgStringVar(&pa2, "pa2", "").Default("y")
+	On("command1", "", &testCmd1{})
+	if res := TryParse(); res != nil {
+		t.Fatal("Try parse must be OK, was", res)
+	}
+	if pa1 != "a" || pa2 != "y" {
+		t.Errorf("preargs expected to be a y, was %s %s", pa1, pa2)
+	}
+}
+
+// Tests that a mandatory pre-arg after an optional pre-arg is rejected
+func TestOptionalPreargsOrder(t *testing.T) {
+	resetForTesting("a", "b", "command1")
+
+	PreArgStringVar(new(string), "pa1", "").Default("x")
+	PreArg("pa2", "")
+	On("command1", "", &testCmd1{})
+	defer func() {
+		if recover() == nil {
+			t.Error("a mandatory pre-arg after an optional pre-arg must panic")
+		}
+	}()
+	TryParse()
+}
+
+// Tests that an optional pre-arg does not consume the command
+func TestOptionalPreargsMissingCommand(t *testing.T) {
+	resetForTesting("a")
+
+	PreArg("pa1", "this is a prearg")
+	PreArgStringVar(new(string), "pa2", "this is an optional prearg").Default("")
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseNoCommand {
+		t.Error("Try parse must be TryParseNoCommand, was", res)
+	}
+}
+
+// Tests that persistent flags are accepted before and after the command name
+func TestPersistentFlags(t *testing.T) {
+	for _, testArgs := range [][]string{{"-verbose", "command1", "foo"}, {"command1", "-verbose", "foo"}} {
+		resetForTesting(testArgs...)
+
+		verbose := flag.Bool("verbose", false, "verbose output")
+		PersistentFlags("verbose")
+		c1 := &testCmd1{}
+		On("command1", "", c1)
+		res := TryParse()
+		if res != nil {
+			t.Error("Try parse must be OK, was", res)
+		}
+		if !*verbose {
+			t.Errorf("%v: verbose expected to be set", testArgs)
+		}
+		if len(args) != 1 || args[0] != "foo" {
+			t.Errorf("%v: args expected to be [foo], was %v", testArgs, args)
+		}
+	}
+}
+
+// Tests that command flags take precedence over persistent flags after the command name
+func TestPersistentFlagsShadowed(t *testing.T) {
+	resetForTesting("command1", "-flag1")
+
+	flag1 := flag.Bool("flag1", false, "global flag1")
+	PersistentFlags("flag1")
+	c1 := &testCmd1{}
+	On("command1", "", c1)
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if *flag1 || !*c1.flag1 {
+		t.Error("command flag1 expected to be set instead of the global flag1")
+	}
+}
+
+// Tests that non-persistent global flags are not accepted after the command name
+func TestNonPersistentFlags(t *testing.T) {
+	resetForTesting("command1", "-verbose")
+
+	flag.Bool("verbose", false, "verbose output")
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseFlagError {
+		t.Error("Try parse must be TryParseFlagError, was", res)
+	}
+}
+
+// Tests that flags can appear after arguments for interspersed commands
+func TestInterspersedFlags(t *testing.T) {
+	resetForTesting("command1", "src", "-flag1", "dest")
+
+	c1 := &testCmd1{}
+	On("command1", "", c1).Interspersed().Arguments("src", "dest")
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if !*c1.flag1 {
+		t.Error("flag1 expected to be set")
+	}
+	if len(args) != 2 || args[0] != "src" || args[1] != "dest" {
+		t.Errorf("args expected to be [src dest], was %v", args)
+	}
+}
+
+// Tests that "--" ends flag processing for interspersed commands
+func TestInterspersedFlagsTerminator(t *testing.T) {
+	resetForTesting("command1", "src", "--", "-flag1", "dest")
+
+	c1 := &testCmd1{}
+	On("command1", "", c1).Interspersed()
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if *c1.flag1 {
+		t.Error("flag1 expected not to be set")
+	}
+	if len(args) != 3 || args[0] != "src" || args[1] != "-flag1" || args[2] != "dest" {
+		t.Errorf("args expected to be [src -flag1 dest], was %v", args)
+	}
+}
+
+// Tests that "--" given as the value of a flag does not end flag processing
+func TestInterspersedFlagsTerminatorValue(t *testing.T) {
+	resetForTesting("command1", "-name", "--", "x", "-force")
+
+	var name string
+	var force bool
+	On("command1", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.StringVar(&name, "name", "", "")
+		fs.BoolVar(&force, "force", false, "")
+	})).Interspersed()
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if name != "--" || !force {
+		t.Errorf("name expected to be -- and force to be set, was %q %v", name, force)
+	}
+	if len(args) != 1 || args[0] != "x" {
+		t.Errorf("args expected to be [x], was %v", args)
+	}
+}
+
+// Tests that flags after arguments are left as arguments for commands which are not interspersed
+func TestNonInterspersedFlags(t *testing.T) {
+	resetForTesting("command1", "src", "-flag1")
+
+	c1 := &testCmd1{}
+	On("command1", "", c1)
+	TryParse()
+	if *c1.flag1 {
+		t.Error("flag1 expected not to be set")
+	}
+	if len(args) != 2 || args[1] != "-flag1" {
+		t.Errorf("args expected to be [src -flag1], was %v", args)
+	}
+}
+
 // Tests try-parse with missing command
 func TestTryParse3(t *testing.T) {
 	resetForTesting("-global1=hello", "prearg")
@@ -359,6 +616,18 @@ func TestTryParseArgs5(t *testing.T) {
 	}
 }
 
+// Tests that optional arguments leave the arguments needed by the mandatory arguments after them
+func TestTryParseOptionalBeforeMandatory(t *testing.T) {
+	for _, testArgs := range [][]string{{"x", "y"}, {"x", "y", "z"}, {"x", "y", "z", "w"}} {
+		resetForTesting(append([]string{"command1"}, testArgs...)...)
+
+		On("command1", "", &testCmd1{}).Arguments("a", "[b]", "...", "c")
+		if res := TryParse(); res != nil {
+			t.Errorf("%v: Try parse must be OK, was %v", testArgs, res)
+		}
+	}
+}
+
 // Tests try-parse with a command with an optional argument
 func TestTryParseArgs6(t *testing.T) {
 	resetForTesting("command1", "foo", "bar")
@@ -395,13 +664,257 @@ func TestTryParseArgs8(t *testing.T) {
 	}
 }
 
+// Tests try-parse with an undefined command flag
+func TestTryParseBadCommandFlag(t *testing.T) {
+	resetForTesting("command1", "-flag2=true")
+
+	c1 := &testCmd1{}
+	On("command1", "", c1)
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseFlagError {
+		t.Error("Try parse must be TryParseFlagError, was", res)
+	}
+}
+
+// Tests that -h shows the command usage once it is no longer reserved
+func TestTryParseCommandHelpFlag(t *testing.T) {
+	resetForTesting("command1", "-h")
+	out := usageForTesting(80)
+
+	OnHelpShowUsage()
+	c1 := &testCmd1{}
+	On("command1", "", c1)
+	if res := TryParse(); res != nil {
+		t.Fatal("Try parse must be OK, was", res)
+	}
+	Run()
+	if c1.run {
+		t.Error("command1 must not run when -h is given")
+	}
+	if !strings.Contains(out.String(), "-flag1") {
+		t.Errorf("command usage expected to be shown, was:\n%s", out.String())
+	}
+}
+
+// Tests that parse errors wrap a sentinel error and record the offending argument
+func TestTryParseErrorDetails(t *testing.T) {
+	resetForTesting("command1", "-flag1", "foo", "bar", "baz")
+
+	c1 := &testCmd1{}
+	On("command1", "", c1).Arguments("this", "that").Interspersed()
+	res := TryParse()
+
+	var parseErr TryParseError
+	if !errors.As(res, &parseErr) {
+		t.Fatal("Try parse must return a TryParseError, was", res)
+	}
+	if !errors.Is(res, ErrTooManyArguments) {
+		t.Error("error must wrap ErrTooManyArguments, was", parseErr.Err)
+	}
+	if parseErr.Index != 5 || parseErr.Received != "baz" {
+		t.Errorf("error must refer to argument 5 \"baz\", was %d %q", parseErr.Index, parseErr.Received)
+	}
+	if parseErr.Message != `command1: too many arguments: unexpected baz` {
+		t.Error("unexpected message:", parseErr.Message)
+	}
+}
+
+// Tests that the unexpected argument is located when it is followed by a flag
+func TestTryParseErrorInterspersed(t *testing.T) {
+	resetForTesting("command1", "x", "y", "-flag1", "z")
+
+	c1 := &testCmd1{}
+	On("command1", "", c1).Arguments("a").Interspersed()
+	parseErr := TryParse().(TryParseError)
+	if parseErr.Index != 3 || parseErr.Received != "y" {
+		t.Errorf("error must refer to argument 3 \"y\", was %d %q", parseErr.Index, parseErr.Received)
+	}
+	if highlight := parseErr.Highlight(); highlight != "  cmd command1 x y -flag1 z\n                 ^" {
+		t.Errorf("unexpected highlight:\n%s", highlight)
+	}
+}
+
+// Tests the details of a missing argument
+func TestTryParseErrorMissingArg(t *testing.T) {
+	resetForTesting("command1", "foo")
+
+	c1 := &testCmd1{}
+	On("command1", "", c1).Arguments("this", "that")
+	res := TryParse()
+	if !errors.Is(res, ErrTooFewArguments) {
+		t.Fatal("error must wrap ErrTooFewArguments, was", res)
+	}
+	parseErr := res.(TryParseError)
+	if parseErr.Index != 3 || parseErr.Expected != "<that>" {
+		t.Errorf("error must expect \"<that>\" at 3, was %q at %d", parseErr.Expected, parseErr.Index)
+	}
+	if highlight := parseErr.Highlight(); highlight != "  cmd command1 foo\n                   ^" {
+		t.Errorf("unexpected highlight:\n%s", highlight)
+	}
+}
+
+// Tests the details of an invalid command and an invalid flag
+func TestTryParseErrorInvalid(t *testing.T) {
+	resetForTesting("-global1=x", "bad command")
+
+	flag.String("global1", "", "")
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if !errors.Is(res, ErrInvalidCommand) {
+		t.Fatal("error must wrap ErrInvalidCommand, was", res)
+	}
+	if highlight := res.(TryParseError).Highlight(); highlight != "  cmd -global1=x 'bad command'\n                 ^^^^^^^^^^^^^" {
+		t.Errorf("unexpected highlight:\n%s", highlight)
+	}
+
+	resetForTesting("command1", "-flag2=true")
+	On("command1", "", &testCmd1{})
+	res = TryParse()
+	if !errors.Is(res, ErrInvalidFlag) || res.(TryParseError).Index != 2 {
+		t.Error("error must wrap ErrInvalidFlag at 2, was", res)
+	}
+}
+
+// Tests that the default command is run when no command is given
+func TestDefaultCommand(t *testing.T) {
+	resetForTesting("pa")
+
+	prearg := PreArg("pa", "")
+	On("command1", "", &testCmd1{})
+	On("command2", "", &testCmd2{}).Arguments("[this]", "...")
+	SetDefault("command2")
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	if matchingCmd == nil || matchingCmd.name != "command2" || len(args) != 0 || *prearg != "pa" {
+		t.Errorf("default command expected without args, was %v %v", matchingCmd, args)
+	}
+}
+
+// Tests that an argument which is not a command name is passed to the default command
+func TestDefaultCommandArgs(t *testing.T) {
+	resetForTesting("foo", "-flag2")
+
+	c2 := &testCmd2{}
+	On("command1", "", &testCmd1{})
+	On("command2", "", c2).Arguments("[this]", "...").Interspersed()
+	SetDefault("command2")
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	if matchingCmd.name != "command2" || len(args) != 1 || args[0] != "foo" || !*c2.flag2 {
+		t.Errorf("default command expected with args [foo], was %s %v", matchingCmd.name, args)
+	}
+
+	resetForTesting("command1")
+	On("command1", "", &testCmd1{})
+	On("command2", "", &testCmd2{})
+	SetDefault("command2")
+	if err := TryParse(); err != nil || matchingCmd.name != "command1" {
+		t.Error("named command must take precedence over the default, was", err)
+	}
+}
+
+// Tests that the default command is marked in the usage
+func TestDefaultCommandUsage(t *testing.T) {
+	resetForTesting()
+	out := usageForTesting(80)
+
+	On("command1", "does command1", &testCmd1{})
+	SetDefault("command1")
+	Usage()
+	if !strings.Contains(out.String(), "  command1  does command1 (default)\n") {
+		t.Errorf("default command must be marked, was:\n%s", out.String())
+	}
+}
+
+// Tests that valid examples are accepted and do not disturb the parsed state
+func TestCheckExamples(t *testing.T) {
+	resetForTesting("-global1=hello", "pa", "command1", "foo")
+
+	g1 := flag.String("global1", "default-global1", "Description about global1")
+	prearg := PreArg("pa", "this is a prearg")
+	c1 := &testCmd1{}
+	On("command1", "", c1).Arguments("this", "[that]").
+		Long("A longer description about command1").
+		Example("-global1=other x command1 foo bar", "runs command1 with two arguments").
+		Example("x command1 -flag1 foo", "")
+	Parse()
+
+	if err := CheckExamples(); err != nil {
+		t.Error("examples must be valid, was", err)
+	}
+	if *g1 != "hello" {
+		t.Error("global flag must be restored after checking examples")
+	}
+	if *prearg != "pa" {
+		t.Error("prearg must be restored after checking examples")
+	}
+	if len(args) != 1 || args[0] != "foo" {
+		t.Error("args must be restored after checking examples")
+	}
+	if *c1.flag1 {
+		t.Error("command flags must be restored after checking examples")
+	}
+}
+
+// Tests that stale examples are reported
+func TestCheckExamplesStale(t *testing.T) {
+	resetForTesting()
+
+	c1 := &testCmd1{}
+	On("command1", "", c1).Arguments("this").
+		Example("command1 -flag1 foo bar", "too many arguments")
+	if err := CheckExamples(); err == nil {
+		t.Error("stale example must be reported")
+	}
+}
+
 // Resets os.Args and the default flag set.
 func resetForTesting(args ...string) {
 	os.Args = append([]string{"cmd"}, args...)
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+    cmds = make(map[string]*cmdCont)
+    matchingCmd = nil
     clearPreArgs()
     reserveHFlag = true
     helpPreargOverride = false
+    persistentFlagNames = make([]string, 0)
+    posixFlags = false
+    globalShortFlags = make(map[string]string)
+    shellInput = os.Stdin
+    shellOutput = os.Stdout
+    promptMissing = false
+    promptReader = nil
+    argFilesEnabled = false
+    pluginsEnabled = false
+    pluginDirs = make([]string, 0)
+    exit = exitProgram
+    osExit = os.Exit
+    signalExit = exitProgram
+    traceRuns = make([]*traceRun, 0)
+    signalsEnabled = false
+    cleanupHooks = make([]func(), 0)
+    describeOutput = os.Stdout
+    catalogs = make(map[string]Catalog)
+    explicitLocale = ""
+    traceFile, traceFormat = nil, nil
+    traceSpans = make([]traceSpan, 0)
+    dryRunEnabled = false
+    defaultCmdName = ""
+    batchInput = os.Stdin
+    batchOutput = os.Stderr
+    chainSeparator = ""
+    chain = nil
+    parsedLinks = nil
+    colorTheme = nil
+    usageIsTerminal = func() bool { return false }
+    usageOutput = os.Stderr
+    usageWidth = func() int { return defaultUsageWidth }
+    versionEnabled = false
+    versionOutput = os.Stdout
+    readBuildInfo = debug.ReadBuildInfo
+    Version, Commit, BuildDate = "", "", ""
 }
 
 // testCmd1 is a test sub command.
@@ -0,0 +1,219 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "encoding/json"
+    "flag"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+// The version of the Description format.  This is incremented whenever a change is made to
+// the format which is not backwards compatible.
+const DescriptionVersion = 1
+
+// The argument which prints the description of the program as JSON.
+const helpJSONArg = "--help-json"
+
+// Where the JSON description is written.
+var describeOutput io.Writer = os.Stdout
+
+// A machine-readable description of the program's commands, pre-arguments and flags.
+type Description struct {
+    Version     int                     `json:"version"`
+    Program     string                  `json:"program"`
+    PreArgs     []PreArgDescription     `json:"preArgs"`
+    Flags       []FlagDescription       `json:"flags"`
+    Commands    []CommandDescription    `json:"commands"`
+}
+
+// A description of a pre-argument.
+type PreArgDescription struct {
+    Name        string                  `json:"name"`
+    Description string                  `json:"description"`
+    Optional    bool                    `json:"optional"`
+    Default     string                  `json:"default,omitempty"`
+    Choices     []string                `json:"choices,omitempty"`
+}
+
+// A description of a global or command flag.  The type is derived from the flag's value and is
+// one of 'bool', 'string', 'int', 'uint', 'float' or 'duration', or 'value' for any other
+// flag.Value.
+type FlagDescription struct {
+    Name        string                  `json:"name"`
+    Short       string                  `json:"short,omitempty"`
+    Type        string                  `json:"type"`
+    Default     string                  `json:"default"`
+    Usage       string                  `json:"usage"`
+    Required    bool                    `json:"required"`
+    Persistent  bool                    `json:"persistent"`
+    Choices     []string                `json:"choices,omitempty"`
+}
+
+// A description of a command.
+type CommandDescription struct {
+    Name        string                  `json:"name"`
+    Description string                  `json:"description"`
+    Long        string                  `json:"long,omitempty"`
+    Arguments   []ArgumentDescription   `json:"arguments"`
+    Flags       []FlagDescription       `json:"flags"`
+    Examples    []ExampleSpec           `json:"examples,omitempty"`
+    DryRun      bool                    `json:"dryRun,omitempty"`
+    Default     bool                    `json:"default,omitempty"`
+}
+
+// A description of a command argument.  The kind is one of 'mandatory', 'optional' or
+// 'variadic'.
+type ArgumentDescription struct {
+    Name        string                  `json:"name"`
+    Kind        string                  `json:"kind"`
+}
+
+// Returns a description of the registered commands, pre-arguments and global flags.
+func Describe() *Description {
+    desc := &Description{
+        Version:    DescriptionVersion,
+        Program:    filepath.Base(os.Args[0]),
+        PreArgs:    make([]PreArgDescription, 0, len(preargdefs)),
+        Flags:      describeFlags(flag.CommandLine, globalShortFlags, nil, nil),
+        Commands:   make([]CommandDescription, 0, len(cmds)),
+    }
+
+    for _, preargdef := range preargdefs {
+        desc.PreArgs = append(desc.PreArgs, PreArgDescription{
+            Name:           preargdef.name,
+            Description:    preargdef.desc,
+            Optional:       preargdef.optional,
+            Default:        preargdef.defValue,
+            Choices:        preargdef.choices,
+        })
+    }
+
+    names := make([]string, 0, len(cmds))
+    for name := range cmds {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    for _, name := range names {
+        cont := cmds[name]
+        fs := cont.command.Flags(flag.NewFlagSet(name, flag.ContinueOnError))
+        cmdDesc := CommandDescription{
+            Name:           name,
+            Description:    cont.desc,
+            Long:           cont.long,
+            Arguments:      make([]ArgumentDescription, 0, len(cont.args)),
+            Flags:          describeFlags(fs, cont.shortFlags, cont.requiredFlags, cont.flagChoices),
+            DryRun:         cont.dryRun,
+            Default:        (name == defaultCmdName),
+        }
+        for _, arg := range cont.args {
+            cmdDesc.Arguments = append(cmdDesc.Arguments, ArgumentDescription{arg.name, arg.argType.String()})
+        }
+        for _, example := range cont.examples {
+            cmdDesc.Examples = append(cmdDesc.Examples, ExampleSpec{example.cmdline, example.explanation})
+        }
+        desc.Commands = append(desc.Commands, cmdDesc)
+    }
+
+    return desc
+}
+
+// Returns the descriptions of the flags in the flag set.
+func describeFlags(fs *flag.FlagSet, shorts map[string]string, required []string, choices map[string][]string) []FlagDescription {
+    longToShort := make(map[string]string)
+    for short, long := range shorts {
+        longToShort[long] = short
+    }
+    requiredMap := make(map[string]bool)
+    for _, name := range required {
+        requiredMap[name] = true
+    }
+    persistentMap := make(map[string]bool)
+    if (fs == flag.CommandLine) {
+        for _, name := range persistentFlagNames {
+            persistentMap[name] = true
+        }
+    }
+
+    flags := make([]FlagDescription, 0)
+    fs.VisitAll(func(f *flag.Flag) {
+        flags = append(flags, FlagDescription{
+            Name:           f.Name,
+            Short:          longToShort[f.Name],
+            Type:           flagType(f),
+            Default:        f.DefValue,
+            Usage:          f.Usage,
+            Required:       requiredMap[f.Name],
+            Persistent:     persistentMap[f.Name],
+            Choices:        choices[f.Name],
+        })
+    })
+    return flags
+}
+
+// Returns the type of the flag's value used in the description.
+func flagType(f *flag.Flag) string {
+    if isBoolFlag(f) {
+        return "bool"
+    }
+    getter, isGetter := f.Value.(flag.Getter)
+    if (!isGetter) {
+        return "value"
+    }
+    switch getter.Get().(type) {
+    case string:
+        return "string"
+    case int, int64:
+        return "int"
+    case uint, uint64:
+        return "uint"
+    case float64:
+        return "float"
+    case time.Duration:
+        return "duration"
+    default:
+        return "value"
+    }
+}
+
+// Returns the kind of the argument used in the description.
+func (at cmdArgType) String() string {
+    switch at {
+    case atOptional:
+        return "optional"
+    case atEllipse:
+        return "variadic"
+    default:
+        return "mandatory"
+    }
+}
+
+// Builtin command for printing the description as JSON.
+type describeCmd struct{}
+
+func (cmd describeCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+    return fs
+}
+
+func (cmd describeCmd) Run(args []string) {
+    encoder := json.NewEncoder(describeOutput)
+    encoder.SetIndent("", "  ")
+    encoder.Encode(Describe())
+}
@@ -0,0 +1,117 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// Registers commands, pre-args and flags to describe.
+func registerForDescribing() {
+	flag.String("global1", "default-global1", "Description about global1")
+	flag.Bool("verbose", false, "verbose output")
+	PersistentFlags("verbose")
+	ShortFlag("v", "verbose")
+	PreArgEnumVar(new(string), "env", "the environment", "dev", "prod")
+	PreArgStringVar(new(string), "region", "the region").Default("us")
+	On("command1", "does command1", &testCmd1{}).
+		Arguments("src", "[dest]", "...").
+		RequiredFlags("flag1").
+		Example("dev command1 -flag1 foo", "")
+	On("command2", "does command2", &testCmd2{}).Long("Does command2 at length")
+}
+
+// Tests describing the program
+func TestDescribe(t *testing.T) {
+	resetForTesting()
+	registerForDescribing()
+
+	desc := Describe()
+	if desc.Version != DescriptionVersion || desc.Program != "cmd" {
+		t.Errorf("version and program expected, was %d %s", desc.Version, desc.Program)
+	}
+
+	expectedPreArgs := []PreArgDescription{
+		{Name: "env", Description: "the environment", Choices: []string{"dev", "prod"}},
+		{Name: "region", Description: "the region", Optional: true, Default: "us"},
+	}
+	if !reflect.DeepEqual(desc.PreArgs, expectedPreArgs) {
+		t.Errorf("pre-args expected to be %+v, was %+v", expectedPreArgs, desc.PreArgs)
+	}
+
+	expectedFlags := []FlagDescription{
+		{Name: "global1", Type: "string", Default: "default-global1", Usage: "Description about global1"},
+		{Name: "verbose", Short: "v", Type: "bool", Default: "false", Usage: "verbose output", Persistent: true},
+	}
+	if !reflect.DeepEqual(desc.Flags, expectedFlags) {
+		t.Errorf("flags expected to be %+v, was %+v", expectedFlags, desc.Flags)
+	}
+
+	if len(desc.Commands) != 2 || desc.Commands[0].Name != "command1" || desc.Commands[1].Long != "Does command2 at length" {
+		t.Fatalf("commands expected to be described in order, was %+v", desc.Commands)
+	}
+	cmd1 := desc.Commands[0]
+	expectedArgs := []ArgumentDescription{{"<src>", "mandatory"}, {"[dest]", "optional"}, {"...", "variadic"}}
+	if !reflect.DeepEqual(cmd1.Arguments, expectedArgs) {
+		t.Errorf("arguments expected to be %+v, was %+v", expectedArgs, cmd1.Arguments)
+	}
+	if len(cmd1.Flags) != 1 || cmd1.Flags[0].Name != "flag1" || !cmd1.Flags[0].Required || cmd1.Flags[0].Type != "bool" {
+		t.Errorf("command flags expected to be described, was %+v", cmd1.Flags)
+	}
+	if len(cmd1.Examples) != 1 {
+		t.Errorf("command examples expected to be described, was %+v", cmd1.Examples)
+	}
+}
+
+// Tests that flag types are derived from the flag values rather than the usage text
+func TestDescribeFlagTypes(t *testing.T) {
+	resetForTesting()
+	flag.Int("count", 0, "the `number` of items")
+	flag.Duration("timeout", 0, "the `time` to wait")
+	flag.Float64("ratio", 0, "the ratio")
+	flag.Func("custom", "a custom `string`", func(string) error { return nil })
+
+	types := make(map[string]string)
+	for _, f := range Describe().Flags {
+		types[f.Name] = f.Type
+	}
+	expected := map[string]string{"count": "int", "timeout": "duration", "ratio": "float", "custom": "value"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("flag types expected to be %v, was %v", expected, types)
+	}
+}
+
+// Tests printing the description with --help-json
+func TestHelpJSON(t *testing.T) {
+	resetForTesting("--help-json")
+	registerForDescribing()
+	buf := new(bytes.Buffer)
+	describeOutput = buf
+
+	Parse()
+	Run()
+
+	var desc Description
+	if err := json.Unmarshal(buf.Bytes(), &desc); err != nil {
+		t.Fatal("description expected to be valid JSON, was", err)
+	}
+	if !reflect.DeepEqual(&desc, Describe()) {
+		t.Errorf("printed description expected to be %+v, was %+v", Describe(), desc)
+	}
+}
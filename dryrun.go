@@ -0,0 +1,86 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "context"
+    "flag"
+)
+
+// The name of the global flag which requests a dry run.
+const dryRunFlagName = "dry-run"
+
+// Indicates whether or not the dry-run flag is enabled.
+var dryRunEnabled bool = false
+
+// The context key of the dry-run indicator.
+type dryRunKey struct{}
+
+// Registers the global '-dry-run' flag, which asks commands to show what they would do
+// without doing it.  The flag is persistent, so it is also accepted after the command name.
+// Only commands marked using `SupportsDryRun` may be run with the flag: for any other command,
+// including plugin commands, the command line parsing fails with the `ErrDryRunUnsupported`
+// error.  Commands read the flag using `IsDryRun` with the context passed to `RunContext`, or
+// using `DryRun`.
+func EnableDryRun() {
+    dryRunEnabled = true
+    if (flag.Lookup(dryRunFlagName) == nil) {
+        flag.Bool(dryRunFlagName, false, "Shows what would be done without doing it")
+    }
+    PersistentFlags(dryRunFlagName)
+}
+
+// Marks the command as supporting dry runs.
+func (cb *CmdBuilder) SupportsDryRun() *CmdBuilder {
+    cb.cmd.dryRun = true
+    return cb
+}
+
+// Returns true if the '-dry-run' flag is set.
+func DryRun() bool {
+    return dryRunRequested(flag.CommandLine)
+}
+
+// Returns true if the command was run with the '-dry-run' flag.
+func IsDryRun(ctx context.Context) bool {
+    dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+    return dryRun
+}
+
+// Returns the context with the dry-run indicator set if the '-dry-run' flag is set.
+func withDryRun(ctx context.Context) context.Context {
+    if DryRun() {
+        return context.WithValue(ctx, dryRunKey{}, true)
+    }
+    return ctx
+}
+
+// Returns true if the dry-run flag is set in the flag set.
+func dryRunRequested(fs *flag.FlagSet) bool {
+    if (!dryRunEnabled) {
+        return false
+    }
+    f := fs.Lookup(dryRunFlagName)
+    return (f != nil) && (f.Value.String() == "true")
+}
+
+// Returns an error if a dry run is requested for a command which does not support it.
+func checkDryRun(globalFlags *flag.FlagSet, cont *cmdCont, argv []string, cmdIndex int) error {
+    if (!dryRunRequested(globalFlags)) || cont.dryRun {
+        return nil
+    }
+    return newParseError(TryParseFlagError, cont.name, ErrDryRunUnsupported, cont.name + ": " + message("-dry-run is not supported by this command"), argv).
+        at(cmdIndex, "", cont.name)
+}
@@ -0,0 +1,99 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the dry-run flag is passed to commands supporting it through the context
+func TestDryRun(t *testing.T) {
+	resetForTesting("-dry-run", "command1")
+	EnableDryRun()
+
+	var runCtx context.Context
+	On("command1", "", contextCmd(func(ctx context.Context) { runCtx = ctx })).SupportsDryRun()
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	Run()
+
+	if !DryRun() || !IsDryRun(runCtx) {
+		t.Error("dry run must be set in the context")
+	}
+}
+
+// Tests that the dry-run flag is accepted after the command name
+func TestDryRunPersistent(t *testing.T) {
+	resetForTesting("command1", "-dry-run")
+	EnableDryRun()
+
+	var runCtx context.Context
+	On("command1", "", contextCmd(func(ctx context.Context) { runCtx = ctx })).SupportsDryRun()
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	Run()
+	if !IsDryRun(runCtx) {
+		t.Error("dry run must be set in the context")
+	}
+}
+
+// Tests that commands not supporting dry runs fail to parse with the flag
+func TestDryRunUnsupported(t *testing.T) {
+	resetForTesting("-dry-run", "command1")
+	EnableDryRun()
+
+	On("command1", "", &testCmd1{})
+	err := TryParse()
+	if !errors.Is(err, ErrDryRunUnsupported) || err.(TryParseError).Reason != TryParseFlagError {
+		t.Fatal("try parse must fail with ErrDryRunUnsupported, was", err)
+	}
+
+	resetForTesting("command1")
+	EnableDryRun()
+	var runCtx context.Context
+	On("command1", "", contextCmd(func(ctx context.Context) { runCtx = ctx }))
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed without the flag, was", err)
+	}
+	Run()
+	if IsDryRun(runCtx) {
+		t.Error("dry run must not be set without the flag")
+	}
+}
+
+// Tests that plugin commands fail to parse with the dry-run flag
+func TestDryRunPlugin(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out")
+	writePlugin(t, dir, "cmd-deploy", outFile, 0)
+	resetForTesting("-dry-run", "deploy")
+	EnableDryRun()
+	EnablePlugins(dir)
+
+	On("command1", "", &testCmd1{})
+	err := TryParse()
+	if !errors.Is(err, ErrDryRunUnsupported) {
+		t.Fatal("try parse must fail with ErrDryRunUnsupported, was", err)
+	}
+	if _, err := os.Stat(outFile); !os.IsNotExist(err) {
+		t.Error("plugin must not be run")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "os/exec"
+)
+
+// Exits the program with the exit status of an external command.
+var exit func(code int) = exitProgram
+
+// Terminates the process.
+var osExit func(code int) = os.Exit
+
+// Records the spans of the commands still running and writes the trace before exiting, as the
+// commands will not return.
+func exitProgram(code int) {
+    finishTrace(code)
+    osExit(code)
+}
+
+// Exits the program with the status.  Commands should use this rather than os.Exit so that,
+// when run in batch mode, the status is recorded for the line and the remaining lines run.
+func Exit(status int) {
+    exit(status)
+}
+
+// Registers a command which runs an external executable or script.  The path is looked up on
+// PATH if it does not contain a path separator.  The command is run with the fixed arguments
+// followed by the arguments after the command name, which are not parsed as flags so that all
+// flags are passed through untouched.  Stdio is forwarded to the executable and, if it fails,
+// the program exits with its exit status.  Returns a CmdBuilder which can be used to further
+// configure the command.
+func OnExec(name, description, path string, fixedArgs ...string) *CmdBuilder {
+    cb := On(name, description, &execCmd{path, fixedArgs})
+    cb.cmd.passthrough = true
+    return cb
+}
+
+// A command which runs an external executable.
+type execCmd struct {
+    path        string
+    fixedArgs   []string
+}
+
+func (cmd *execCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+    return fs
+}
+
+func (cmd *execCmd) Run(args []string) {
+    runExternal(cmd.path, append(append([]string{}, cmd.fixedArgs...), args...), nil)
+}
+
+// Runs an external executable with the arguments, forwarding stdio.  If the executable fails,
+// the program exits with its exit status.
+func runExternal(path string, args []string, env []string) {
+    cmd := exec.Command(path, args...)
+    cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+    cmd.Env = append(os.Environ(), env...)
+
+    if err := cmd.Run(); err != nil {
+        if exitErr, isExitErr := err.(*exec.ExitError); isExitErr && (exitErr.ExitCode() > 0) {
+            exit(exitErr.ExitCode())
+        } else {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+            exit(1)
+        }
+    }
+}
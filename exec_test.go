@@ -0,0 +1,62 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests running an external script with fixed and passed through arguments
+func TestOnExec(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out")
+	writePlugin(t, dir, "script", outFile, 2)
+	resetForTesting("wrapped", "-unknown", "--flag=x", "arg")
+
+	OnExec("wrapped", "a wrapped script", filepath.Join(dir, "script"), "fixed")
+	exitCode := 0
+	exit = func(code int) { exitCode = code }
+
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	Run()
+
+	out, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := strings.Split(string(out), "\n")[0]; line != "fixed -unknown --flag=x arg" {
+		t.Errorf("script arguments expected to be 'fixed -unknown --flag=x arg', was '%s'", line)
+	}
+	if exitCode != 2 {
+		t.Errorf("exit code expected to be 2, was %d", exitCode)
+	}
+}
+
+// Tests that arguments of external commands are still validated
+func TestOnExecArguments(t *testing.T) {
+	resetForTesting("wrapped")
+
+	OnExec("wrapped", "a wrapped script", "/bin/true").Arguments("file")
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseArgError {
+		t.Error("Try parse must be TryParseArgError, was", res)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "flag"
+    "strings"
+)
+
+// The kinds of constraint on a group of flags.
+type flagGroupKind int
+
+const (
+    // At most one of the flags may be set.
+    fgMutuallyExclusive flagGroupKind = iota
+    // Exactly one of the flags must be set.
+    fgExactlyOne
+    // At least one of the flags must be set.
+    fgAtLeastOne
+    // If the first flag is set, all of the others must be set.
+    fgRequires
+)
+
+// A constraint on a group of command flags.
+type flagGroup struct {
+    kind        flagGroupKind
+    names       []string
+}
+
+// Declares that at most one of the named flags may be set.  Setting more than one fails the
+// command line parsing with the `ErrMutuallyExclusiveFlags` error.
+func (cb *CmdBuilder) MutuallyExclusiveFlags(names ...string) *CmdBuilder {
+    cb.cmd.flagGroups = append(cb.cmd.flagGroups, flagGroup{fgMutuallyExclusive, names})
+    return cb
+}
+
+// Declares that exactly one of the named flags must be set.  Setting none fails the command
+// line parsing with the `ErrMissingFlagGroup` error and setting more than one fails it with the
+// `ErrMutuallyExclusiveFlags` error.
+func (cb *CmdBuilder) ExactlyOneOfFlags(names ...string) *CmdBuilder {
+    cb.cmd.flagGroups = append(cb.cmd.flagGroups, flagGroup{fgExactlyOne, names})
+    return cb
+}
+
+// Declares that at least one of the named flags must be set.  Setting none fails the command
+// line parsing with the `ErrMissingFlagGroup` error.
+func (cb *CmdBuilder) AtLeastOneOfFlags(names ...string) *CmdBuilder {
+    cb.cmd.flagGroups = append(cb.cmd.flagGroups, flagGroup{fgAtLeastOne, names})
+    return cb
+}
+
+// Declares that if the named flag is set, the required flags must also be set.  Setting the
+// flag without them fails the command line parsing with the `ErrFlagRequires` error.
+func (cb *CmdBuilder) FlagRequires(name string, required ...string) *CmdBuilder {
+    cb.cmd.flagGroups = append(cb.cmd.flagGroups, flagGroup{fgRequires, append([]string{name}, required...)})
+    return cb
+}
+
+// Returns the flag names with dashes, separated by commas.
+func dashedFlagNames(names []string) string {
+    dashed := make([]string, 0, len(names))
+    for _, name := range names {
+        dashed = append(dashed, "-" + name)
+    }
+    return strings.Join(dashed, ", ")
+}
+
+// Returns a description of the constraint as it appears in the usage string.
+func (fg flagGroup) String() string {
+    switch fg.kind {
+    case fgMutuallyExclusive:
+        return message("at most one of: %s", dashedFlagNames(fg.names))
+    case fgExactlyOne:
+        return message("exactly one of: %s", dashedFlagNames(fg.names))
+    case fgAtLeastOne:
+        return message("at least one of: %s", dashedFlagNames(fg.names))
+    default:
+        return message("-%s requires: %s", fg.names[0], dashedFlagNames(fg.names[1:]))
+    }
+}
+
+// Checks the constraint against the flags set in the flag set.  Returns the message describing
+// the violation, the flags of the group which are set and the sentinel error, which is nil if
+// the constraint is met.
+func (fg flagGroup) check(fs *flag.FlagSet) (string, []string, error) {
+    setFlags := make(map[string]bool)
+    fs.Visit(func(f *flag.Flag) {
+        setFlags[f.Name] = true
+    })
+
+    set := make([]string, 0, len(fg.names))
+    missing := make([]string, 0, len(fg.names))
+    for _, name := range fg.names {
+        if (setFlags[name]) {
+            set = append(set, name)
+        } else {
+            missing = append(missing, name)
+        }
+    }
+
+    switch fg.kind {
+    case fgMutuallyExclusive, fgExactlyOne:
+        if (len(set) > 1) {
+            return message("flags cannot be used together: %s", dashedFlagNames(set)), set, ErrMutuallyExclusiveFlags
+        } else if (fg.kind == fgExactlyOne) && (len(set) == 0) {
+            return message("exactly one of the flags is required: %s", dashedFlagNames(fg.names)), set, ErrMissingFlagGroup
+        }
+    case fgAtLeastOne:
+        if (len(set) == 0) {
+            return message("at least one of the flags is required: %s", dashedFlagNames(fg.names)), set, ErrMissingFlagGroup
+        }
+    case fgRequires:
+        if setFlags[fg.names[0]] && (len(missing) > 0) {
+            return message("-%s requires: %s", fg.names[0], dashedFlagNames(missing)), set, ErrFlagRequires
+        }
+    }
+    return "", set, nil
+}
+
+// Checks the flag constraints of the command, returning the error for the first constraint
+// which is not met.
+func checkFlagGroups(cont *cmdCont, fs *flag.FlagSet, argv []string) error {
+    for _, fg := range cont.flagGroups {
+        if msg, set, err := fg.check(fs); err != nil {
+            return newParseError(TryParseFlagError, cont.name, err, cont.name + ": " + msg, argv).
+                at(-1, fg.String(), dashedFlagNames(set))
+        }
+    }
+    return nil
+}
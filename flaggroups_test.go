@@ -0,0 +1,92 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+// Registers a command with flag constraints.
+func registerFlagGroups(arguments ...string) {
+	resetForTesting(arguments...)
+	On("fetch", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.String("file", "", "")
+		fs.String("url", "", "")
+		fs.String("user", "", "")
+		fs.String("password", "", "")
+		fs.Bool("a", false, "")
+		fs.Bool("b", false, "")
+		fs.Bool("q", false, "")
+		fs.Bool("v", false, "")
+	})).
+		ExactlyOneOfFlags("file", "url").
+		FlagRequires("user", "password").
+		AtLeastOneOfFlags("a", "b").
+		MutuallyExclusiveFlags("q", "v")
+}
+
+// Tests that command lines meeting the constraints are accepted
+func TestFlagGroupsValid(t *testing.T) {
+	registerFlagGroups("fetch", "-url=x", "-user=u", "-password=p", "-a", "-b", "-q")
+	if err := TryParse(); err != nil {
+		t.Error("try parse must succeed, was", err)
+	}
+}
+
+// Tests the error of each violated constraint
+func TestFlagGroupsViolations(t *testing.T) {
+	tests := []struct {
+		arguments []string
+		err       error
+		message   string
+	}{
+		{[]string{"-a"}, ErrMissingFlagGroup, "fetch: exactly one of the flags is required: -file, -url"},
+		{[]string{"-file=f", "-url=u", "-a"}, ErrMutuallyExclusiveFlags, "fetch: flags cannot be used together: -file, -url"},
+		{[]string{"-file=f", "-user=u", "-a"}, ErrFlagRequires, "fetch: -user requires: -password"},
+		{[]string{"-file=f"}, ErrMissingFlagGroup, "fetch: at least one of the flags is required: -a, -b"},
+		{[]string{"-file=f", "-a", "-q", "-v"}, ErrMutuallyExclusiveFlags, "fetch: flags cannot be used together: -q, -v"},
+	}
+
+	for _, test := range tests {
+		registerFlagGroups(append([]string{"fetch"}, test.arguments...)...)
+		err := TryParse()
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: error expected to be %v, was %v", test.arguments, test.err, err)
+			continue
+		}
+		if parseErr := err.(TryParseError); parseErr.Reason != TryParseFlagError || parseErr.Message != test.message {
+			t.Errorf("%v: unexpected error %d %q", test.arguments, parseErr.Reason, parseErr.Message)
+		}
+	}
+}
+
+// Tests that the constraints are documented in the command usage
+func TestFlagGroupsUsage(t *testing.T) {
+	registerFlagGroups()
+	out := usageForTesting(80)
+	subcommandUsageByName("fetch")
+
+	expected := "Flag constraints:\n" +
+		"  exactly one of: -file, -url\n" +
+		"  -user requires: -password\n" +
+		"  at least one of: -a, -b\n" +
+		"  at most one of: -q, -v\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("usage must document the constraints, was:\n%s", out.String())
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Where the usage is written.
+var usageOutput io.Writer = os.Stderr
+
+// The width used when the terminal width cannot be determined.
+const defaultUsageWidth = 80
+
+// The narrowest width text is wrapped to, so that descriptions remain readable next to long
+// names on narrow terminals.
+const minWrapWidth = 20
+
+// Returns the width the usage is wrapped to.  This is the value of the COLUMNS environment
+// variable if set, otherwise the width of the terminal on stderr, otherwise 80.
+var usageWidth func() int = func() int {
+    if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); (err == nil) && (columns > 0) {
+        return columns
+    }
+    if width := terminalWidth(int(os.Stderr.Fd())); width > 0 {
+        return width
+    }
+    return defaultUsageWidth
+}
+
+// A row of a two column usage table, such as a command name and its description.
+type usageRow struct {
+    name        string
+    desc        string
+}
+
+// Prints rows with the names aligned to the longest name and the descriptions wrapped to the
+// usage width with a hanging indent.  Names which are longer than a third of the width are
+// printed on their own line, with the description on the line below.  The names are styled
+// using nameStyle.
+func printUsageTable(rows []usageRow, nameStyle string) {
+    width := usageWidth()
+
+    nameWidth := 0
+    for _, row := range rows {
+        if n := utf8.RuneCountInString(row.name); (n > nameWidth) && (n <= width / 3) {
+            nameWidth = n
+        }
+    }
+
+    indent := 2 + nameWidth + 2
+    for _, row := range rows {
+        name := "  " + colorize(nameStyle, row.name)
+        if (utf8.RuneCountInString(row.name) > nameWidth) {
+            if (row.desc == "") {
+                fmt.Fprintln(usageOutput, name)
+            } else {
+                fmt.Fprintf(usageOutput, "%s\n%s\n", name, wrapText(row.desc, width, indent, indent))
+            }
+            continue
+        }
+
+        if (row.desc == "") {
+            fmt.Fprintln(usageOutput, name)
+            continue
+        }
+        name += strings.Repeat(" ", indent - 2 - utf8.RuneCountInString(row.name))
+        fmt.Fprintf(usageOutput, "%s%s\n", name, wrapText(row.desc, width, indent, 0))
+    }
+}
+
+// Prints a section heading.
+func printUsageHeading(heading string) {
+    fmt.Fprintln(usageOutput, colorize(activeTheme().Heading, heading))
+}
+
+// Prints a paragraph of text wrapped to the usage width, indented by indent.
+func printUsageText(text string, indent int) {
+    fmt.Fprintln(usageOutput, wrapText(text, usageWidth(), indent, indent))
+}
+
+// Wraps text to width columns.  Every line but the first is indented by indent columns, with
+// the first line indented by firstIndent columns.  Line breaks in the text are preserved, and
+// words longer than the available width are not broken.
+func wrapText(text string, width, indent, firstIndent int) string {
+    available := width - indent
+    if (available < minWrapWidth) {
+        available = minWrapWidth
+    }
+
+    var out strings.Builder
+    out.WriteString(strings.Repeat(" ", firstIndent))
+    for i, paragraph := range strings.Split(text, "\n") {
+        if (i > 0) {
+            out.WriteString("\n" + strings.Repeat(" ", indent))
+        }
+
+        lineLen := 0
+        for _, word := range strings.Fields(paragraph) {
+            wordLen := utf8.RuneCountInString(word)
+            if (lineLen > 0) && (lineLen + 1 + wordLen > available) {
+                out.WriteString("\n" + strings.Repeat(" ", indent))
+                lineLen = 0
+            } else if (lineLen > 0) {
+                out.WriteString(" ")
+                lineLen++
+            }
+            out.WriteString(word)
+            lineLen += wordLen
+        }
+    }
+    return out.String()
+}
+
+// Returns the usage row of a flag, shown as the flag names and type followed by the usage and
+// the default value.  When POSIX style flags are enabled, flags are shown with their short
+// aliases and double dashes.
+func flagUsageRow(f *flag.Flag, longToShort map[string]string) usageRow {
+    var names string
+    if short, hasShort := longToShort[f.Name]; posixFlags && hasShort {
+        names = "-" + short + ", --" + f.Name
+    } else if (!posixFlags) || (len(f.Name) == 1) {
+        names = "-" + f.Name
+    } else {
+        names = "--" + f.Name
+    }
+
+    translated := *f
+    translated.Usage = message(f.Usage)
+    typeName, usage := flag.UnquoteUsage(&translated)
+    if (typeName != "") {
+        names += " " + typeName
+    }
+
+    if (f.DefValue != "") && (f.DefValue != "false") && (f.DefValue != "0") {
+        if (typeName == "string") {
+            usage += " (" + message("default %q", f.DefValue) + ")"
+        } else {
+            usage += " (" + message("default %v", f.DefValue) + ")"
+        }
+    }
+    return usageRow{names, usage}
+}
@@ -0,0 +1,122 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+// Captures the usage output, wrapped to the given width.
+func usageForTesting(width int) *bytes.Buffer {
+	out := new(bytes.Buffer)
+	usageOutput = out
+	usageWidth = func() int { return width }
+	return out
+}
+
+// Tests wrapping text with a hanging indent
+func TestWrapText(t *testing.T) {
+	wrapped := wrapText("the quick brown fox jumps over the lazy dog", 24, 4, 0)
+	expected := "the quick brown fox\n    jumps over the lazy\n    dog"
+	if wrapped != expected {
+		t.Errorf("wrapped text expected to be %q, was %q", expected, wrapped)
+	}
+
+	wrapped = wrapText("first line\nsecond", 80, 2, 2)
+	if wrapped != "  first line\n  second" {
+		t.Errorf("line breaks must be preserved, was %q", wrapped)
+	}
+}
+
+// Tests that commands are aligned to the longest name and descriptions are wrapped
+func TestUsageAlignment(t *testing.T) {
+	resetForTesting()
+	out := usageForTesting(60)
+
+	On("a", "short", &testCmd1{})
+	On("a-much-longer-name", "does something which needs a long description", &testCmd2{})
+	Usage()
+
+	expected := "Usage: cmd <command>\n\n" +
+		"where <command> is one of:\n" +
+		"  a                   short\n" +
+		"  a-much-longer-name  does something which needs a long\n" +
+		"                      description\n" +
+		"\ncmd <command> -h for subcommand help\n"
+	if out.String() != expected {
+		t.Errorf("unexpected usage:\n%s", out.String())
+	}
+}
+
+// Tests that names longer than a third of the width are printed on their own line
+func TestUsageLongName(t *testing.T) {
+	resetForTesting()
+	out := usageForTesting(30)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("v", false, "verbose output")
+	fs.String("a-very-long-flag-name", "x", "a flag")
+	printFlagDefaults(fs, nil)
+
+	expected := "  -a-very-long-flag-name string\n" +
+		"      a flag (default \"x\")\n" +
+		"  -v  verbose output\n"
+	if out.String() != expected {
+		t.Errorf("unexpected flag usage:\n%s", out.String())
+	}
+}
+
+// Tests that colors are used when enabled and the output is a terminal
+func TestUsageColors(t *testing.T) {
+	resetForTesting()
+	out := usageForTesting(80)
+	t.Setenv("NO_COLOR", "")
+
+	On("command1", "does command1", &testCmd1{})
+	UseColors(Theme{Heading: "1", Command: "36"})
+	usageIsTerminal = func() bool { return true }
+	Usage()
+
+	expected := "\x1b[1mUsage:\x1b[0m cmd \x1b[36m<command>\x1b[0m\n\n" +
+		"\x1b[1mwhere <command> is one of:\x1b[0m\n" +
+		"  \x1b[36mcommand1\x1b[0m  does command1\n"
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Errorf("unexpected colored usage:\n%q", out.String())
+	}
+}
+
+// Tests that colors are disabled when NO_COLOR is set or the output is not a terminal
+func TestUsageNoColors(t *testing.T) {
+	resetForTesting()
+	out := usageForTesting(80)
+	On("command1", "does command1", &testCmd1{})
+	UseColors(DefaultTheme)
+
+	Usage()
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Errorf("colors must not be used when the output is not a terminal, was %q", out.String())
+	}
+
+	out.Reset()
+	usageIsTerminal = func() bool { return true }
+	t.Setenv("NO_COLOR", "1")
+	Usage()
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Errorf("colors must not be used when NO_COLOR is set, was %q", out.String())
+	}
+}
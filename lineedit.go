@@ -0,0 +1,474 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// The maximum number of lines kept in the shell history.
+const historyLimit = 1000
+
+// Control keys understood by the line editor.
+const (
+    keyCtrlA        =   1
+    keyCtrlB        =   2
+    keyCtrlC        =   3
+    keyCtrlD        =   4
+    keyCtrlE        =   5
+    keyCtrlF        =   6
+    keyCtrlG        =   7
+    keyBackspace    =   8
+    keyTab          =   9
+    keyLineFeed     =   10
+    keyCtrlK        =   11
+    keyCtrlL        =   12
+    keyEnter        =   13
+    keyCtrlN        =   14
+    keyCtrlP        =   16
+    keyCtrlR        =   18
+    keyCtrlU        =   21
+    keyCtrlW        =   23
+    keyEscape       =   27
+    keyDelete       =   127
+)
+
+// Returns the completion candidates of the word being typed at the end of line, which is the
+// text before the cursor.  If there are no candidates, the returned hint is displayed instead.
+type completer func(line string) (candidates []string, hint string)
+
+// A line editor supporting cursor movement, history, reverse search and tab completion.  The
+// terminal is expected to be in raw mode while reading a line.
+type lineEditor struct {
+    in          *bufio.Reader
+    out         io.Writer
+    prompt      string
+    complete    completer
+
+    history     []string
+    historyFile string
+
+    buf         []rune
+    pos         int
+}
+
+func newLineEditor(in io.Reader, out io.Writer, prompt string, complete completer) *lineEditor {
+    return &lineEditor{in: bufio.NewReader(in), out: out, prompt: prompt, complete: complete}
+}
+
+// Loads the history from the file, which will also have new lines appended to it.  Missing
+// history files are ignored.
+func (le *lineEditor) loadHistory(filename string) {
+    le.historyFile = filename
+
+    f, err := os.Open(filename)
+    if err != nil {
+        return
+    }
+    defer f.Close()
+
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        if (scanner.Text() != "") {
+            le.history = append(le.history, scanner.Text())
+        }
+    }
+    if (len(le.history) > historyLimit) {
+        le.history = le.history[len(le.history) - historyLimit:]
+    }
+}
+
+// Adds the line to the history, appending it to the history file if one is loaded.  Empty
+// lines and repeats of the last line are not added.
+func (le *lineEditor) addHistory(line string) {
+    if (strings.TrimSpace(line) == "") || ((len(le.history) > 0) && (le.history[len(le.history) - 1] == line)) {
+        return
+    }
+
+    le.history = append(le.history, line)
+    if (len(le.history) > historyLimit) {
+        le.history = le.history[1:]
+    }
+
+    if (le.historyFile != "") {
+        if err := os.MkdirAll(filepath.Dir(le.historyFile), 0700); err != nil {
+            return
+        }
+        f, err := os.OpenFile(le.historyFile, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0600)
+        if err != nil {
+            return
+        }
+        defer f.Close()
+        fmt.Fprintln(f, line)
+    }
+}
+
+// Reads a line.  Returns io.EOF if Ctrl-D is pressed on an empty line or the input ends.
+func (le *lineEditor) readLine() (string, error) {
+    le.buf = le.buf[:0]
+    le.pos = 0
+    histIndex := len(le.history)
+    savedLine := ""
+    le.refresh()
+
+    for {
+        r, _, err := le.in.ReadRune()
+        if err != nil {
+            return "", err
+        }
+
+        switch r {
+        case keyEnter, keyLineFeed:
+            fmt.Fprint(le.out, "\r\n")
+            return string(le.buf), nil
+        case keyCtrlD:
+            if (len(le.buf) == 0) {
+                return "", io.EOF
+            }
+            le.deleteRunes(le.pos, le.pos + 1)
+        case keyCtrlC:
+            fmt.Fprint(le.out, "^C\r\n")
+            le.buf = le.buf[:0]
+            le.pos = 0
+            histIndex = len(le.history)
+        case keyCtrlA:
+            le.pos = 0
+        case keyCtrlE:
+            le.pos = len(le.buf)
+        case keyCtrlB:
+            le.moveCursor(-1)
+        case keyCtrlF:
+            le.moveCursor(1)
+        case keyBackspace, keyDelete:
+            if (le.pos > 0) {
+                le.deleteRunes(le.pos - 1, le.pos)
+            }
+        case keyCtrlK:
+            le.deleteRunes(le.pos, len(le.buf))
+        case keyCtrlU:
+            le.deleteRunes(0, le.pos)
+        case keyCtrlW:
+            start := le.pos
+            for (start > 0) && (le.buf[start - 1] == ' ') {
+                start--
+            }
+            for (start > 0) && (le.buf[start - 1] != ' ') {
+                start--
+            }
+            le.deleteRunes(start, le.pos)
+        case keyCtrlL:
+            fmt.Fprint(le.out, "\x1b[H\x1b[2J")
+        case keyCtrlP, keyCtrlN:
+            histIndex, savedLine = le.moveHistory(histIndex, savedLine, r == keyCtrlP)
+        case keyCtrlR:
+            if line, accepted := le.reverseSearch(); accepted {
+                fmt.Fprint(le.out, "\r\n")
+                return line, nil
+            }
+        case keyTab:
+            le.completeWord()
+        case keyEscape:
+            switch le.readEscapeSequence() {
+            case "[A", "OA":
+                histIndex, savedLine = le.moveHistory(histIndex, savedLine, true)
+            case "[B", "OB":
+                histIndex, savedLine = le.moveHistory(histIndex, savedLine, false)
+            case "[C", "OC":
+                le.moveCursor(1)
+            case "[D", "OD":
+                le.moveCursor(-1)
+            case "[H", "OH", "[1~", "[7~":
+                le.pos = 0
+            case "[F", "OF", "[4~", "[8~":
+                le.pos = len(le.buf)
+            case "[3~":
+                le.deleteRunes(le.pos, le.pos + 1)
+            }
+        default:
+            if (r >= ' ') {
+                le.insertRunes([]rune{r})
+            }
+        }
+
+        le.refresh()
+    }
+}
+
+// Reads the remainder of an escape sequence following the escape character.
+func (le *lineEditor) readEscapeSequence() string {
+    seq := make([]rune, 0, 4)
+    for {
+        r, _, err := le.in.ReadRune()
+        if err != nil {
+            return string(seq)
+        }
+        seq = append(seq, r)
+
+        // Sequences end with a letter or '~', apart from the introducing character
+        if (len(seq) > 1) && (((r >= 'A') && (r <= 'Z')) || ((r >= 'a') && (r <= 'z')) || (r == '~')) {
+            return string(seq)
+        } else if (len(seq) == 1) && (r != '[') && (r != 'O') {
+            return string(seq)
+        }
+    }
+}
+
+// Redraws the prompt and the line, placing the cursor at the current position.
+func (le *lineEditor) refresh() {
+    fmt.Fprintf(le.out, "\r%s%s\x1b[K", le.prompt, string(le.buf))
+    if (le.pos < len(le.buf)) {
+        fmt.Fprintf(le.out, "\x1b[%dD", len(le.buf) - le.pos)
+    }
+}
+
+func (le *lineEditor) moveCursor(delta int) {
+    le.pos += delta
+    if (le.pos < 0) {
+        le.pos = 0
+    } else if (le.pos > len(le.buf)) {
+        le.pos = len(le.buf)
+    }
+}
+
+func (le *lineEditor) insertRunes(rs []rune) {
+    newBuf := make([]rune, 0, len(le.buf) + len(rs))
+    newBuf = append(newBuf, le.buf[:le.pos]...)
+    newBuf = append(newBuf, rs...)
+    le.buf = append(newBuf, le.buf[le.pos:]...)
+    le.pos += len(rs)
+}
+
+// Deletes the runes between start and end, clamped to the line.
+func (le *lineEditor) deleteRunes(start, end int) {
+    if (end > len(le.buf)) {
+        end = len(le.buf)
+    }
+    if (start >= end) {
+        return
+    }
+    le.buf = append(le.buf[:start], le.buf[end:]...)
+    if (le.pos > end) {
+        le.pos -= end - start
+    } else if (le.pos > start) {
+        le.pos = start
+    }
+}
+
+// Replaces the line with the previous or next history entry.  The line being edited is saved
+// when moving away from it so that it can be returned to.
+func (le *lineEditor) moveHistory(histIndex int, savedLine string, up bool) (int, string) {
+    if (up) && (histIndex > 0) {
+        if (histIndex == len(le.history)) {
+            savedLine = string(le.buf)
+        }
+        histIndex--
+        le.buf = []rune(le.history[histIndex])
+    } else if (!up) && (histIndex < len(le.history)) {
+        histIndex++
+        if (histIndex == len(le.history)) {
+            le.buf = []rune(savedLine)
+        } else {
+            le.buf = []rune(le.history[histIndex])
+        }
+    }
+    le.pos = len(le.buf)
+    return histIndex, savedLine
+}
+
+// Searches backwards through the history for lines containing the typed text.  Pressing Ctrl-R
+// again finds the next older match.  Enter runs the match, returning it with accepted set to
+// true.  Ctrl-G or Ctrl-C abandons the search, and any other key leaves the match in the line
+// for editing.
+func (le *lineEditor) reverseSearch() (line string, accepted bool) {
+    query := make([]rune, 0)
+    matchIndex := len(le.history)
+    match := ""
+
+    search := func(from int) {
+        if (from >= len(le.history)) {
+            from = len(le.history) - 1
+        }
+        for i := from; i >= 0; i-- {
+            if strings.Contains(le.history[i], string(query)) {
+                matchIndex = i
+                match = le.history[i]
+                return
+            }
+        }
+    }
+
+    for {
+        fmt.Fprintf(le.out, "\r%s\x1b[K", message("(reverse-i-search)`%s': %s", string(query), match))
+
+        r, _, err := le.in.ReadRune()
+        if err != nil {
+            return "", false
+        }
+
+        switch r {
+        case keyEnter, keyLineFeed:
+            return match, true
+        case keyCtrlG, keyCtrlC:
+            return "", false
+        case keyCtrlR:
+            search(matchIndex - 1)
+        case keyBackspace, keyDelete:
+            if (len(query) > 0) {
+                query = query[:len(query) - 1]
+                search(len(le.history) - 1)
+            }
+        default:
+            if (r >= ' ') {
+                query = append(query, r)
+                search(matchIndex)
+            } else {
+                if (r == keyEscape) {
+                    le.readEscapeSequence()
+                }
+                le.buf = []rune(match)
+                le.pos = len(le.buf)
+                return "", false
+            }
+        }
+    }
+}
+
+// Completes the word before the cursor.  A single candidate is inserted in full, otherwise the
+// longest common prefix of the candidates is inserted and, if that adds nothing, the candidates
+// are listed.
+func (le *lineEditor) completeWord() {
+    if (le.complete == nil) {
+        return
+    }
+
+    before := string(le.buf[:le.pos])
+    word := before[strings.LastIndex(before, " ") + 1:]
+    candidates, hint := le.complete(before)
+
+    if (len(candidates) == 0) {
+        if (hint != "") {
+            fmt.Fprintf(le.out, "\r\n%s\r\n", hint)
+        }
+        return
+    } else if (len(candidates) == 1) {
+        le.insertRunes([]rune(strings.TrimPrefix(candidates[0], word) + " "))
+        return
+    }
+
+    prefix := commonPrefix(candidates)
+    if (len(prefix) > len(word)) {
+        le.insertRunes([]rune(strings.TrimPrefix(prefix, word)))
+    } else {
+        fmt.Fprintf(le.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+    }
+}
+
+// Returns the longest common prefix of the strings.
+func commonPrefix(strs []string) string {
+    prefix := strs[0]
+    for _, s := range strs[1:] {
+        for !strings.HasPrefix(s, prefix) {
+            prefix = prefix[:len(prefix) - 1]
+        }
+    }
+    return prefix
+}
+
+// Completes the command names, flag names and argument patterns of the registered commands.
+func completeShellLine(line string) ([]string, string) {
+    fields := strings.Fields(line)
+    word := ""
+    if (len(fields) > 0) && !strings.HasSuffix(line, " ") {
+        word = fields[len(fields) - 1]
+        fields = fields[:len(fields) - 1]
+    }
+
+    // Complete the command name
+    if (len(fields) == 0) || ((fields[0] == "help") && (len(fields) == 1)) {
+        names := []string{"exit", "help"}
+        if (len(fields) > 0) {
+            names = nil
+        }
+        for name := range cmds {
+            names = append(names, name)
+        }
+        return filterPrefix(names, word), ""
+    }
+
+    cont, hasCmd := cmds[fields[0]]
+    if (!hasCmd) {
+        return nil, ""
+    }
+
+    // Complete the flag names
+    fs := cont.command.Flags(flag.NewFlagSet(cont.name, flag.ContinueOnError))
+    addPersistentFlags(flag.CommandLine, fs, fs)
+    if strings.HasPrefix(word, "-") {
+        names := make([]string, 0)
+        fs.VisitAll(func(f *flag.Flag) {
+            if (posixFlags) && (len(f.Name) > 1) {
+                names = append(names, "--" + f.Name)
+            } else {
+                names = append(names, "-" + f.Name)
+            }
+        })
+        return filterPrefix(names, word), ""
+    }
+
+    // Show the remaining arguments as the hint
+    argCount := 0
+    for _, field := range fields[1:] {
+        if !strings.HasPrefix(field, "-") {
+            argCount++
+        }
+    }
+    remaining := make([]string, 0)
+    for _, arg := range cont.args {
+        if (arg.argType == atEllipse) || (argCount == 0) {
+            remaining = append(remaining, arg.name)
+        } else {
+            argCount--
+        }
+    }
+    return nil, strings.Join(remaining, " ")
+}
+
+// Returns the sorted strings which start with prefix.
+func filterPrefix(strs []string, prefix string) []string {
+    filtered := make([]string, 0)
+    for _, s := range strs {
+        if strings.HasPrefix(s, prefix) {
+            filtered = append(filtered, s)
+        }
+    }
+    sort.Strings(filtered)
+    return filtered
+}
+
+// Returns the default path of the shell history file, which is in the user's config directory.
+func defaultHistoryFile() string {
+    configDir, err := os.UserConfigDir()
+    if err != nil {
+        return ""
+    }
+    return filepath.Join(configDir, filepath.Base(os.Args[0]), "shell_history")
+}
@@ -0,0 +1,136 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Reads lines from the line editor until the input ends.
+func readEditorLines(le *lineEditor) []string {
+	lines := make([]string, 0)
+	for {
+		line, err := le.readLine()
+		if err != nil {
+			return lines
+		}
+		le.addHistory(line)
+		lines = append(lines, line)
+	}
+}
+
+// Tests editing keys
+func TestLineEditorEditing(t *testing.T) {
+	input := "abc\x1b[D\x1b[DX\x05\x7f\r" + // aXb
+		"hello world\x17there\r" + // hello there
+		"abc\x01\x0b\r" + // (empty)
+		"abc\x03def\r" // def
+	le := newLineEditor(strings.NewReader(input), ioutil.Discard, "> ", nil)
+	lines := readEditorLines(le)
+	expected := []string{"aXb", "hello there", "", "def"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, was %q", expected, lines)
+	}
+}
+
+// Tests Ctrl-D on an empty line
+func TestLineEditorEOF(t *testing.T) {
+	le := newLineEditor(strings.NewReader("\x04abc\r"), ioutil.Discard, "> ", nil)
+	if _, err := le.readLine(); err != io.EOF {
+		t.Error("expected EOF, was", err)
+	}
+}
+
+// Tests moving through the history
+func TestLineEditorHistory(t *testing.T) {
+	input := "one\rtwo\r\x1b[A\x1b[A\r" + "three\x1b[A\x1b[A\x1b[B\x1b[B\r"
+	le := newLineEditor(strings.NewReader(input), ioutil.Discard, "> ", nil)
+	lines := readEditorLines(le)
+	expected := []string{"one", "two", "one", "three"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, was %q", expected, lines)
+	}
+	if !reflect.DeepEqual(le.history, expected) {
+		t.Errorf("history expected to be %q, was %q", expected, le.history)
+	}
+}
+
+// Tests reverse search through the history
+func TestLineEditorReverseSearch(t *testing.T) {
+	input := "deploy prod\rstatus\rdeploy dev\r" +
+		"\x12dep\x12\r" + // deploy prod
+		"\x12stat\x06 -v\r" // status -v
+	le := newLineEditor(strings.NewReader(input), ioutil.Discard, "> ", nil)
+	lines := readEditorLines(le)
+	expected := []string{"deploy prod", "status", "deploy dev", "deploy prod", "status -v"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, was %q", expected, lines)
+	}
+}
+
+// Tests that the history is kept in the history file
+func TestLineEditorHistoryFile(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "dir", "history")
+
+	le := newLineEditor(strings.NewReader("one\rtwo\r"), ioutil.Discard, "> ", nil)
+	le.loadHistory(historyFile)
+	readEditorLines(le)
+
+	le = newLineEditor(strings.NewReader(""), ioutil.Discard, "> ", nil)
+	le.loadHistory(historyFile)
+	expected := []string{"one", "two"}
+	if !reflect.DeepEqual(le.history, expected) {
+		t.Errorf("history expected to be %q, was %q", expected, le.history)
+	}
+}
+
+// Tests tab completion of commands, flags and arguments
+func TestLineEditorCompletion(t *testing.T) {
+	resetForTesting()
+
+	On("command1", "", &testCmd1{}).Arguments("src", "[dest]")
+	On("command2", "", &testCmd2{})
+	On("other", "", &testCmd2{})
+
+	input := "oth\t\r" + "com\t1 -fl\tx\r" + "help oth\t\r"
+	le := newLineEditor(strings.NewReader(input), ioutil.Discard, "> ", completeShellLine)
+	lines := readEditorLines(le)
+	expected := []string{"other ", "command1 -flag1 x", "help other "}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, was %q", expected, lines)
+	}
+
+	for _, test := range []struct {
+		line       string
+		candidates []string
+		hint       string
+	}{
+		{"", []string{"command1", "command2", "exit", "help", "other"}, ""},
+		{"command", []string{"command1", "command2"}, ""},
+		{"command1 ", nil, "<src> [dest]"},
+		{"command1 -flag1 x ", nil, "[dest]"},
+		{"unknown ", nil, ""},
+	} {
+		candidates, hint := completeShellLine(test.line)
+		if !reflect.DeepEqual(candidates, test.candidates) || hint != test.hint {
+			t.Errorf("%q: expected %q %q, was %q %q", test.line, test.candidates, test.hint, candidates, hint)
+		}
+	}
+}
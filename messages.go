@@ -0,0 +1,105 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "fmt"
+    "os"
+    "strings"
+)
+
+// A catalog of translated messages for a locale.  Messages are identified by the English
+// fmt format string used by this package, such as "where <command> is one of:" or
+// "too few arguments: missing %s", and a translation must contain the same verbs in the
+// same order.  The descriptions of commands, pre-arguments and flags, including those of the
+// builtin commands and flags such as "Displays usage string of commands", are also looked up
+// when the usage is displayed.
+type Catalog interface {
+    // Returns the translation of the message, or false if the message is not translated.
+    Translate(message string) (string, bool)
+}
+
+// A catalog backed by a map from the English messages to their translations.
+type MapCatalog map[string]string
+
+func (mc MapCatalog) Translate(message string) (string, bool) {
+    translation, ok := mc[message]
+    return translation, ok
+}
+
+// The registered catalogs, keyed by locale.
+var catalogs map[string]Catalog = make(map[string]Catalog)
+
+// The locale set using `SetLocale`.  If empty, the locale is read from the environment.
+var explicitLocale string = ""
+
+// Registers the message catalog for a locale, such as "de" or "pt_BR".  When looking up a
+// message, the catalog for the full locale is tried before the catalog for the language.
+func AddCatalog(locale string, catalog Catalog) {
+    catalogs[normalizeLocale(locale)] = catalog
+}
+
+// Sets the locale used for messages, overriding the locale from the environment.  The empty
+// string reverts to the environment.
+func SetLocale(locale string) {
+    explicitLocale = locale
+}
+
+// Returns the locale used for messages.  This is the locale set using `SetLocale`, otherwise
+// the first of the LC_ALL, LC_MESSAGES and LANG environment variables which is set.
+func Locale() string {
+    if (explicitLocale != "") {
+        return normalizeLocale(explicitLocale)
+    }
+    for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+        if locale := os.Getenv(name); locale != "" {
+            return normalizeLocale(locale)
+        }
+    }
+    return ""
+}
+
+// Strips the encoding and modifier from a POSIX locale, such as "de_DE.UTF-8@euro", and
+// converts BCP 47 style separators, such as in "pt-BR", to underscores.
+func normalizeLocale(locale string) string {
+    if i := strings.IndexAny(locale, ".@"); i >= 0 {
+        locale = locale[:i]
+    }
+    return strings.Replace(locale, "-", "_", -1)
+}
+
+// Returns the message translated for the current locale and formatted with the arguments.  The
+// English message is used if there is no translation.
+func message(format string, a ...interface{}) string {
+    if locale := Locale(); (locale != "") && (locale != "C") && (locale != "POSIX") {
+        candidates := []string{locale}
+        if i := strings.Index(locale, "_"); i >= 0 {
+            candidates = append(candidates, locale[:i])
+        }
+        for _, candidate := range candidates {
+            if catalog, hasCatalog := catalogs[candidate]; hasCatalog {
+                if translation, ok := catalog.Translate(format); ok {
+                    format = translation
+                    break
+                }
+            }
+        }
+    }
+
+    if (len(a) == 0) {
+        return format
+    }
+    return fmt.Sprintf(format, a...)
+}
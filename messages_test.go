@@ -0,0 +1,91 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests selecting the locale from the environment and explicitly
+func TestLocale(t *testing.T) {
+	resetForTesting()
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "de_DE.UTF-8")
+	if Locale() != "de_DE" {
+		t.Error("locale must be read from LANG, was", Locale())
+	}
+
+	t.Setenv("LC_MESSAGES", "fr_FR")
+	if Locale() != "fr_FR" {
+		t.Error("LC_MESSAGES must take precedence over LANG, was", Locale())
+	}
+
+	SetLocale("pt-BR")
+	if Locale() != "pt_BR" {
+		t.Error("explicit locale must take precedence, was", Locale())
+	}
+}
+
+// Tests that messages are translated, falling back to the language and then to English
+func TestMessageCatalog(t *testing.T) {
+	resetForTesting()
+	AddCatalog("de", MapCatalog{
+		"missing command":            "Befehl fehlt",
+		"where <command> is one of:": "wobei <command> einer ist von:",
+	})
+	SetLocale("de_AT")
+
+	if msg := message("missing command"); msg != "Befehl fehlt" {
+		t.Error("message must be translated using the language catalog, was", msg)
+	}
+	if msg := message("invalid command: %s", "foo"); msg != "invalid command: foo" {
+		t.Error("untranslated message must fall back to English, was", msg)
+	}
+
+	resetForTesting("command2")
+	AddCatalog("de", MapCatalog{"too few arguments: missing %s": "zu wenige Argumente: %s fehlt"})
+	SetLocale("de")
+	On("command2", "", &testCmd2{}).Arguments("src")
+	if err := TryParse(); err == nil || !strings.HasSuffix(err.Error(), "zu wenige Argumente: <src> fehlt") {
+		t.Error("parse errors must be translated, was", err)
+	}
+}
+
+// Tests that the descriptions of builtin commands and flags and pre-argument errors are translated
+func TestMessageCatalogBuiltins(t *testing.T) {
+	resetForTesting("x", "command1")
+	out := usageForTesting(80)
+	AddCatalog("de", MapCatalog{
+		"Displays usage string of commands":         "Zeigt die Hilfe der Befehle an",
+		"Shows what would be done without doing it": "Zeigt, was getan würde",
+		"not an integer":                            "keine Ganzzahl",
+	})
+	SetLocale("de")
+
+	OnHelpShowUsage()
+	EnableDryRun()
+	var count int
+	PreArgIntVar(&count, "count", "")
+	On("command1", "", &testCmd1{})
+	Usage()
+	if !strings.Contains(out.String(), "Zeigt die Hilfe der Befehle an") || !strings.Contains(out.String(), "Zeigt, was getan würde") {
+		t.Errorf("builtin descriptions must be translated, was:\n%s", out.String())
+	}
+	if err := TryParse(); err == nil || !strings.HasSuffix(err.Error(), "keine Ganzzahl") {
+		t.Error("pre-argument errors must be translated, was", err)
+	}
+}
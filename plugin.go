@@ -0,0 +1,141 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "flag"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Indicates whether or not plugin commands are looked up.
+var pluginsEnabled bool = false
+
+// Directories searched for plugins before PATH.
+var pluginDirs []string = make([]string, 0)
+
+// Enables plugin commands.  When a command name is not registered, an executable named
+// '<program>-<name>' is looked up in the passed in plugin directories and then on PATH.  If one
+// is found, it is run with the arguments following the command name, unparsed, and the program
+// exits with the plugin's exit status if it fails.  The global flags and pre-arguments are
+// passed to the plugin as the environment variables '<PROGRAM>_FLAG_<NAME>' and
+// '<PROGRAM>_PREARG_<NAME>'.  The discovered plugins are listed in the usage.
+func EnablePlugins(dirs ...string) {
+    pluginsEnabled = true
+    pluginDirs = append(pluginDirs, dirs...)
+}
+
+// Returns the prefix of the plugin executable names.
+func pluginPrefix() string {
+    return filepath.Base(os.Args[0]) + "-"
+}
+
+// Looks up the plugin for the command name.  Returns the empty string if there is none, or
+// if plugins are not enabled.
+func findPlugin(name string) string {
+    if (!pluginsEnabled) || (name == "") || strings.ContainsRune(name, os.PathSeparator) {
+        return ""
+    }
+
+    for _, dir := range pluginDirs {
+        path := filepath.Join(dir, pluginPrefix() + name)
+        if isExecutable(path) {
+            return path
+        }
+    }
+    if path, err := exec.LookPath(pluginPrefix() + name); err == nil {
+        return path
+    }
+    return ""
+}
+
+// Returns the sorted names of the plugins found in the plugin directories and on PATH.
+// Only names which `findPlugin` resolves are returned, so an extension is only dropped if the
+// plugin can be run without it, such as with PATHEXT on Windows.  Plugins with the same name
+// as a registered command are excluded.
+func discoverPlugins() []string {
+    dirs := append(append([]string{}, pluginDirs...), filepath.SplitList(os.Getenv("PATH"))...)
+    found := make(map[string]bool)
+    for _, dir := range dirs {
+        files, err := ioutil.ReadDir(dir)
+        if err != nil {
+            continue
+        }
+        for _, file := range files {
+            if !strings.HasPrefix(file.Name(), pluginPrefix()) {
+                continue
+            }
+            name := strings.TrimPrefix(file.Name(), pluginPrefix())
+            for _, candidate := range []string{name, strings.TrimSuffix(name, filepath.Ext(name))} {
+                if _, hasCmd := cmds[candidate]; !hasCmd && (findPlugin(candidate) != "") {
+                    found[candidate] = true
+                }
+            }
+        }
+    }
+
+    names := make([]string, 0, len(found))
+    for name := range found {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Returns true if the path is an executable file.
+func isExecutable(path string) bool {
+    info, err := os.Stat(path)
+    return (err == nil) && info.Mode().IsRegular() && (info.Mode().Perm() & 0111 != 0)
+}
+
+// Returns the environment variables passing the global flags and pre-arguments to a plugin.
+func pluginEnv() []string {
+    prefix := envName(filepath.Base(os.Args[0]))
+    env := make([]string, 0)
+    flag.VisitAll(func(f *flag.Flag) {
+        env = append(env, prefix + "_FLAG_" + envName(f.Name) + "=" + f.Value.String())
+    })
+    for _, preargdef := range preargdefs {
+        env = append(env, prefix + "_PREARG_" + envName(preargdef.name) + "=" + preargdef.value.String())
+    }
+    return env
+}
+
+// Converts the name into an environment variable name.
+func envName(name string) string {
+    return strings.Map(func(r rune) rune {
+        if ((r >= 'a') && (r <= 'z')) {
+            return r - 'a' + 'A'
+        } else if ((r >= 'A') && (r <= 'Z')) || ((r >= '0') && (r <= '9')) {
+            return r
+        }
+        return '_'
+    }, name)
+}
+
+// A command which runs a plugin.
+type pluginCmd string
+
+func (cmd pluginCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+    return fs
+}
+
+func (cmd pluginCmd) Run(args []string) {
+    runExternal(string(cmd), args, pluginEnv())
+}
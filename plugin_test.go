@@ -0,0 +1,111 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Writes a shell script plugin to the directory which records its arguments and environment
+// to the output file and exits with the passed in status.
+func writePlugin(t *testing.T, dir, name, outFile string, status int) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin scripts not supported on windows")
+	}
+	script := "#!/bin/sh\necho \"$@\" > " + outFile + "\necho \"$CMD_FLAG_GLOBAL1 $CMD_PREARG_PA\" >> " + outFile + "\nexit " + strconv.Itoa(status) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests running a plugin from a plugin directory
+func TestPlugin(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out")
+	writePlugin(t, dir, "cmd-deploy", outFile, 3)
+	resetForTesting("-global1=hello", "pa", "deploy", "-flag", "arg")
+
+	EnablePlugins(dir)
+	flag.String("global1", "default-global1", "Description about global1")
+	PreArg("pa", "this is a prearg")
+	On("command1", "", &testCmd1{})
+	exitCode := 0
+	exit = func(code int) { exitCode = code }
+
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	Run()
+
+	out, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	expected := []string{"-flag arg", "hello pa"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("plugin output expected to be %q, was %q", expected, lines)
+	}
+	if exitCode != 3 {
+		t.Errorf("exit code expected to be 3, was %d", exitCode)
+	}
+}
+
+// Tests discovering plugins
+func TestDiscoverPlugins(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "cmd-deploy", "/dev/null", 0)
+	writePlugin(t, dir, "cmd-command1", "/dev/null", 0)
+	ioutil.WriteFile(filepath.Join(dir, "cmd-notexec"), []byte(""), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "other-thing"), []byte(""), 0755)
+	writePlugin(t, dir, "cmd-build.sh", "/dev/null", 0)
+	writePlugin(t, dir, "cmd-my.tool", "/dev/null", 0)
+	resetForTesting()
+
+	EnablePlugins(dir)
+	On("command1", "", &testCmd1{})
+	plugins := discoverPlugins()
+	expected := []string{"build.sh", "deploy", "my.tool"}
+	if !reflect.DeepEqual(plugins, expected) {
+		t.Errorf("plugins expected to be %v, was %v", expected, plugins)
+	}
+	for _, plugin := range plugins {
+		if findPlugin(plugin) == "" {
+			t.Errorf("listed plugin %s must be runnable", plugin)
+		}
+	}
+}
+
+// Tests that plugins are not used unless enabled
+func TestPluginsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "cmd-deploy", "/dev/null", 0)
+	resetForTesting("deploy")
+
+	On("command1", "", &testCmd1{})
+	pluginDirs = []string{dir}
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseInvalidCommand {
+		t.Error("Try parse must be TryParseInvalidCommand, was", res)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "flag"
+    "strings"
+)
+
+// Indicates whether or not POSIX/GNU style flags are used.
+var posixFlags bool = false
+
+// Short flag aliases of the global flags, mapping the short name to the long name.
+var globalShortFlags map[string]string = make(map[string]string)
+
+// Switches both the global flags and the command flags to POSIX/GNU style flags.  In this mode:
+//
+//      --name, --name=value    - A long flag.  Non-boolean flags without '=' take the next
+//                                argument as the value.
+//      --no-name               - Sets the boolean flag 'name' to false.
+//      -v                      - A short flag, either a flag with a single character name or
+//                                a short alias registered using `ShortFlag`.
+//      -xvf, -ofile            - Combined short flags.  The first non-boolean flag takes the
+//                                remainder of the argument, or the next argument, as the value.
+//
+// Flags are still defined using the flag package, with the flag name being the long name.
+func UsePosixFlags() {
+    posixFlags = true
+}
+
+// Registers a single character short alias for a global flag.  Short aliases are only used when
+// POSIX style flags are enabled with `UsePosixFlags`.
+func ShortFlag(short, long string) {
+    globalShortFlags[short] = long
+}
+
+// Registers a single character short alias for one of the command flags.  Short aliases are
+// only used when POSIX style flags are enabled with `UsePosixFlags`.
+func (cb *CmdBuilder) ShortFlag(short, long string) *CmdBuilder {
+    if (cb.cmd.shortFlags == nil) {
+        cb.cmd.shortFlags = make(map[string]string)
+    }
+    cb.cmd.shortFlags[short] = long
+    return cb
+}
+
+// The flag package's interface for boolean flags.
+type boolFlag interface {
+    flag.Value
+    IsBoolFlag() bool
+}
+
+// Returns true if the flag is a boolean flag.
+func isBoolFlag(f *flag.Flag) bool {
+    bf, isBool := f.Value.(boolFlag)
+    return isBool && bf.IsBoolFlag()
+}
+
+// Returns the short aliases which apply to the command flag set, which includes the aliases
+// of any persistent global flags added to the flag set.
+func cmdShortFlags(cont *cmdCont, fs *flag.FlagSet) map[string]string {
+    shorts := make(map[string]string)
+    for short, long := range globalShortFlags {
+        if (fs.Lookup(long) != nil) {
+            shorts[short] = long
+        }
+    }
+    for short, long := range cont.shortFlags {
+        shorts[short] = long
+    }
+    return shorts
+}
+
+// Rewrites POSIX style flags to the form understood by the flag package.  Rewriting stops at
+// the first non-flag argument unless interspersed is true, and always stops at "--".  Undefined
+// flags are passed through so that the flag package reports them.
+func translatePosixArgs(fs *flag.FlagSet, shorts map[string]string, arguments []string, interspersed bool) []string {
+    out := make([]string, 0, len(arguments))
+
+    for i := 0; i < len(arguments); i++ {
+        arg := arguments[i]
+
+        if (arg == "--") {
+            return append(out, arguments[i:]...)
+        } else if (len(arg) < 2) || (arg[0] != '-') {
+            if (!interspersed) {
+                return append(out, arguments[i:]...)
+            }
+            out = append(out, arg)
+            continue
+        }
+
+        if strings.HasPrefix(arg, "--") {
+            name := arg[2:]
+            hasValue := strings.Contains(name, "=")
+            if (hasValue) {
+                name = name[:strings.Index(name, "=")]
+            }
+
+            f := fs.Lookup(name)
+            if (f == nil) && (!hasValue) && strings.HasPrefix(name, "no-") {
+                if nf := fs.Lookup(name[3:]); (nf != nil) && isBoolFlag(nf) {
+                    out = append(out, "-" + nf.Name + "=false")
+                    continue
+                }
+            }
+
+            out = append(out, "-" + arg[2:])
+            if (f != nil) && (!hasValue) && (!isBoolFlag(f)) && (i + 1 < len(arguments)) {
+                i++
+                out = append(out, arguments[i])
+            }
+            continue
+        }
+
+        // Combined short flags
+        shortArgs := arg[1:]
+        for j, c := range shortArgs {
+            short := string(c)
+            long, hasLong := shorts[short]
+            if (!hasLong) {
+                long = short
+            }
+
+            f := fs.Lookup(long)
+            if (f == nil) {
+                out = append(out, "-" + short)
+                break
+            } else if isBoolFlag(f) {
+                out = append(out, "-" + long)
+                continue
+            }
+
+            value := strings.TrimPrefix(shortArgs[j + len(short):], "=")
+            if (value != "") {
+                out = append(out, "-" + long + "=" + value)
+            } else {
+                out = append(out, "-" + long)
+                if (i + 1 < len(arguments)) {
+                    i++
+                    out = append(out, arguments[i])
+                }
+            }
+            break
+        }
+    }
+
+    return out
+}
+
+// Prints the defaults of the flags in the flag set, aligned and wrapped to the usage width.
+// When POSIX style flags are enabled, flags are shown with their short aliases and double
+// dashes.
+func printFlagDefaults(fs *flag.FlagSet, shorts map[string]string) {
+    longToShort := make(map[string]string)
+    for short, long := range shorts {
+        longToShort[long] = short
+    }
+
+    rows := make([]usageRow, 0)
+    fs.VisitAll(func(f *flag.Flag) {
+        rows = append(rows, flagUsageRow(f, longToShort))
+    })
+    printUsageTable(rows, activeTheme().Flag)
+}
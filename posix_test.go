@@ -0,0 +1,131 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"flag"
+	"testing"
+)
+
+// Tests long global flags and short aliases
+func TestPosixGlobalFlags(t *testing.T) {
+	resetForTesting("-v", "--name", "foo", "command1")
+
+	UsePosixFlags()
+	verbose := flag.Bool("verbose", false, "verbose output")
+	name := flag.String("name", "", "the name")
+	ShortFlag("v", "verbose")
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if !*verbose {
+		t.Error("verbose expected to be set")
+	}
+	if *name != "foo" {
+		t.Errorf("name expected to be 'foo', was %s", *name)
+	}
+}
+
+// Tests combined short flags with a value
+func TestPosixCombinedShortFlags(t *testing.T) {
+	resetForTesting("command1", "-xvofile", "arg")
+
+	UsePosixFlags()
+	var x, v bool
+	var o string
+	On("command1", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.BoolVar(&x, "x", false, "")
+		fs.BoolVar(&v, "verbose", false, "")
+		fs.StringVar(&o, "output", "", "")
+	})).ShortFlag("v", "verbose").ShortFlag("o", "output")
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if !x || !v || o != "file" {
+		t.Errorf("flags expected to be set, were %v %v %s", x, v, o)
+	}
+	if len(args) != 1 || args[0] != "arg" {
+		t.Errorf("args expected to be [arg], was %v", args)
+	}
+}
+
+// Tests --flag=value and --no-flag negation
+func TestPosixLongFlags(t *testing.T) {
+	resetForTesting("command1", "--output=file", "--no-verbose", "-o", "other")
+
+	UsePosixFlags()
+	var v bool
+	var o string
+	On("command1", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.BoolVar(&v, "verbose", true, "")
+		fs.StringVar(&o, "output", "", "")
+	})).ShortFlag("o", "output")
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if v {
+		t.Error("verbose expected to be unset")
+	}
+	if o != "other" {
+		t.Errorf("output expected to be 'other', was %s", o)
+	}
+}
+
+// Tests that POSIX flags stop at the first argument
+func TestPosixFlagsStopAtArgument(t *testing.T) {
+	resetForTesting("command1", "arg", "-x")
+
+	UsePosixFlags()
+	var x bool
+	On("command1", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.BoolVar(&x, "x", false, "")
+	}))
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if x || len(args) != 2 {
+		t.Errorf("-x expected to be an argument, args were %v", args)
+	}
+}
+
+// Tests undefined POSIX flags
+func TestPosixUndefinedFlag(t *testing.T) {
+	resetForTesting("command1", "-xq")
+
+	UsePosixFlags()
+	On("command1", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.Bool("x", false, "")
+	}))
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseFlagError {
+		t.Error("Try parse must be TryParseFlagError, was", res)
+	}
+}
+
+// A command which defines flags using a function.
+type flagsCmd func(fs *flag.FlagSet)
+
+func (cmd flagsCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd(fs)
+	return fs
+}
+
+func (cmd flagsCmd) Run(args []string) {
+}
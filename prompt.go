@@ -0,0 +1,190 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// Indicates whether or not to prompt for missing values.
+var promptMissing bool = false
+
+// The input and output used for prompting.
+var promptInput io.Reader = os.Stdin
+var promptOutput io.Writer = os.Stderr
+var promptReader *bufio.Reader = nil
+
+// Returns true if the prompt input is interactive.
+var promptIsInteractive func() bool = func() bool {
+    f, isFile := promptInput.(*os.File)
+    return isFile && isTerminal(int(f.Fd()))
+}
+
+// Enables prompting for missing values.  When a mandatory pre-argument, mandatory argument or
+// required flag is missing and stdin is a terminal, the user is prompted for the value instead
+// of failing the command line parsing.  The description of the pre-argument or flag is used as
+// the prompt, input is hidden for flags marked using `SecretFlags`, and a menu of choices is
+// displayed for enum pre-arguments and flags with choices.  When stdin is not a terminal, the
+// command line parsing fails as normal.
+func PromptForMissing() {
+    promptMissing = true
+}
+
+// Marks the named flags as secret, hiding the input when prompting for them.
+func (cb *CmdBuilder) SecretFlags(names ...string) *CmdBuilder {
+    if (cb.cmd.secretFlags == nil) {
+        cb.cmd.secretFlags = make(map[string]bool)
+    }
+    for _, name := range names {
+        cb.cmd.secretFlags[name] = true
+    }
+    return cb
+}
+
+// Returns true if prompting for missing values is enabled and possible.
+func canPrompt() bool {
+    return promptMissing && promptIsInteractive()
+}
+
+// Prompts for a value.  If choices is not empty, the choices are displayed as a numbered menu
+// and either the number or the value of a choice is accepted.  If secret is true, input is not
+// echoed.  Prompting is repeated until a valid value is entered, returning an error if the
+// input ends.
+func promptValue(label string, choices []string, secret bool) (string, error) {
+    if (promptReader == nil) {
+        promptReader = bufio.NewReader(promptInput)
+    }
+
+    if (len(choices) > 0) {
+        fmt.Fprintf(promptOutput, "%s:\n", label)
+        for i, choice := range choices {
+            fmt.Fprintf(promptOutput, "  %d) %s\n", i + 1, choice)
+        }
+    }
+
+    for {
+        if (len(choices) > 0) {
+            fmt.Fprintf(promptOutput, "%s ", message("Choice:"))
+        } else {
+            fmt.Fprintf(promptOutput, "%s: ", label)
+        }
+
+        line, err := readPromptLine(secret)
+        if err != nil {
+            return "", err
+        }
+
+        if (len(choices) == 0) {
+            if (line != "") {
+                return line, nil
+            }
+            continue
+        }
+
+        if n, err := strconv.Atoi(line); (err == nil) && (n >= 1) && (n <= len(choices)) {
+            return choices[n - 1], nil
+        }
+        for _, choice := range choices {
+            if (line == choice) {
+                return choice, nil
+            }
+        }
+        fmt.Fprintf(promptOutput, "%s\n", message("invalid choice: %s", line))
+    }
+}
+
+// Reads a line of prompt input, with echo disabled if secret is true.
+func readPromptLine(secret bool) (string, error) {
+    if (secret) {
+        if f, isFile := promptInput.(*os.File); isFile {
+            if restore, err := disableEcho(int(f.Fd())); err == nil {
+                defer func() {
+                    restore()
+                    fmt.Fprintln(promptOutput)
+                }()
+            }
+        }
+    }
+
+    line, err := promptReader.ReadString('\n')
+    if (err != nil) && ((err != io.EOF) || (line == "")) {
+        return "", err
+    }
+    return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Prompts for a missing pre-argument, setting it if a valid value is entered.
+func promptPreArg(pa *preArgDef) error {
+    label := message(pa.desc)
+    if (label == "") {
+        label = pa.name
+    }
+
+    for {
+        val, err := promptValue(label + " <" + pa.name + ">", pa.choices, false)
+        if err != nil {
+            return err
+        }
+        if err := pa.set(val); err != nil {
+            fmt.Fprintf(promptOutput, "%v\n", err)
+            continue
+        }
+        return nil
+    }
+}
+
+// Prompts for the missing mandatory arguments of a command, returning the arguments with the
+// entered values appended.
+func promptArgs(ca cmdArgs, args []string) ([]string, error) {
+    for _, arg := range ca.missing(args) {
+        val, err := promptValue(arg.name, nil, false)
+        if err != nil {
+            return nil, err
+        }
+        args = append(args, val)
+    }
+    return args, nil
+}
+
+// Prompts for a missing required flag, setting it in the flag set.
+func promptFlag(cont *cmdCont, fs *flag.FlagSet, name string) error {
+    f := fs.Lookup(name)
+    if (f == nil) {
+        return fmt.Errorf("undefined flag: %s", name)
+    }
+
+    label := message(f.Usage)
+    if (label == "") {
+        label = name
+    }
+
+    for {
+        val, err := promptValue(label + " (-" + name + ")", cont.flagChoices[name], cont.secretFlags[name])
+        if err != nil {
+            return err
+        }
+        if err := fs.Set(name, val); err != nil {
+            fmt.Fprintf(promptOutput, "%s\n", message("invalid value %q for -%s: %v", val, name, err))
+            continue
+        }
+        return nil
+    }
+}
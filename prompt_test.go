@@ -0,0 +1,129 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// Sets up prompting with the passed in input.
+func promptForTesting(input string) {
+	PromptForMissing()
+	promptInput = strings.NewReader(input)
+	promptOutput = ioutil.Discard
+	promptIsInteractive = func() bool { return true }
+}
+
+// Tests prompting for missing pre-args
+func TestPromptPreargs(t *testing.T) {
+	resetForTesting()
+	promptForTesting("abc\n42\n3\n2\n")
+
+	var port int
+	var env string
+	PreArgIntVar(&port, "port", "the port")
+	PreArgEnumVar(&env, "env", "the environment", "dev", "prod")
+	On("command1", "", &testCmd1{})
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseNoCommand {
+		t.Error("Try parse must be TryParseNoCommand, was", res)
+	}
+	if port != 42 {
+		t.Errorf("port expected to be 42, was %d", port)
+	}
+	if env != "prod" {
+		t.Errorf("env expected to be 'prod', was %s", env)
+	}
+}
+
+// Tests prompting for missing arguments and required flags
+func TestPromptArgsAndFlags(t *testing.T) {
+	resetForTesting("command1", "foo")
+	promptForTesting("\nsecret\nxml\njson\nbar\n")
+
+	var password, format string
+	On("command1", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.StringVar(&password, "password", "", "the password")
+		fs.StringVar(&format, "format", "", "the output format")
+	})).Arguments("src", "dest", "[other]").
+		RequiredFlags("password", "format").
+		SecretFlags("password").
+		FlagChoices("format", "text", "json")
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	if password != "secret" || format != "json" {
+		t.Errorf("flags expected to be set, were %s %s", password, format)
+	}
+	if len(args) != 2 || args[0] != "foo" || args[1] != "bar" {
+		t.Errorf("args expected to be [foo bar], was %v", args)
+	}
+}
+
+// Tests that a prompted argument is not taken by an optional argument before it
+func TestPromptArgsAfterOptional(t *testing.T) {
+	resetForTesting("command1", "x")
+	promptForTesting("y\n")
+
+	On("command1", "", &testCmd1{}).Arguments("a", "[b]", "c")
+	if res := TryParse(); res != nil {
+		t.Fatal("Try parse must be OK, was", res)
+	}
+	if len(args) != 2 || args[0] != "x" || args[1] != "y" {
+		t.Errorf("args expected to be [x y], was %v", args)
+	}
+}
+
+// Tests that the original errors are returned when not interactive
+func TestPromptNotInteractive(t *testing.T) {
+	resetForTesting("command1")
+	promptForTesting("foo\n")
+	promptIsInteractive = func() bool { return false }
+
+	On("command1", "", &testCmd1{}).Arguments("src")
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseArgError {
+		t.Error("Try parse must be TryParseArgError, was", res)
+	}
+}
+
+// Tests that the original errors are returned when the input ends
+func TestPromptEndOfInput(t *testing.T) {
+	resetForTesting("command1")
+	promptForTesting("")
+
+	On("command1", "", &testCmd1{}).RequiredFlags("flag1")
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseInvalidCommand {
+		t.Error("Try parse must be TryParseInvalidCommand, was", res)
+	}
+}
+
+// Tests that flag values must be one of the choices
+func TestFlagChoices(t *testing.T) {
+	resetForTesting("command1", "-format=xml")
+
+	On("command1", "", flagsCmd(func(fs *flag.FlagSet) {
+		fs.String("format", "text", "the output format")
+	})).FlagChoices("format", "text", "json")
+	res := TryParse()
+	if res == nil || res.(TryParseError).Reason != TryParseFlagError {
+		t.Error("Try parse must be TryParseFlagError, was", res)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "unicode"
+)
+
+// The input and output of the interactive shell.
+var shellInput io.Reader = os.Stdin
+var shellOutput io.Writer = os.Stdout
+
+// Returns the path of the shell history file.
+var shellHistoryFile func() string = defaultHistoryFile
+
+// Registers a shell command which starts an interactive shell.  The shell reads command lines
+// from stdin and runs them against the registered commands, with the global flags and
+// pre-arguments set when the shell was started kept for the whole session.  Command lines are
+// split into arguments using shell-like quoting.  The shell also provides the builtins 'help',
+// which displays the usage of the commands, and 'exit', which ends the shell.  If prompt is
+// the empty string, the program name is used as the prompt.
+//
+// When stdin is a terminal, lines can be edited and the shell supports history, reverse search
+// using Ctrl-R and tab completion of command names, flag names and arguments.  The history is
+// kept in a file in the user's config directory, which can be changed using `ShellHistoryFile`.
+func OnShell(prompt string) {
+    if (prompt == "") {
+        prompt = filepath.Base(os.Args[0]) + "> "
+    }
+    On("shell", "Starts an interactive shell", &shellCmd{prompt}).SupportsDryRun()
+}
+
+// Sets the file used to keep the shell history.  The empty string disables persistent history.
+func ShellHistoryFile(filename string) {
+    shellHistoryFile = func() string { return filename }
+}
+
+// Builtin command for running an interactive shell.
+type shellCmd struct {
+    prompt      string
+}
+
+func (cmd *shellCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+    return fs
+}
+
+func (cmd *shellCmd) Run(_ []string) {
+    savedMatchingCmd, savedArgs, savedFlagHelp := matchingCmd, args, flagHelp
+    defer func() {
+        matchingCmd, args, flagHelp = savedMatchingCmd, savedArgs, savedFlagHelp
+    }()
+
+    if f, isFile := shellInput.(*os.File); isFile && isTerminal(int(f.Fd())) {
+        cmd.runLineEditor(f)
+        return
+    }
+
+    scanner := bufio.NewScanner(shellInput)
+    for {
+        fmt.Fprint(shellOutput, cmd.prompt)
+        if (!scanner.Scan()) {
+            fmt.Fprintln(shellOutput)
+            return
+        }
+        if (!runShellLine(scanner.Text())) {
+            return
+        }
+    }
+}
+
+// Runs the shell using the line editor, with the terminal in raw mode while reading lines.
+func (cmd *shellCmd) runLineEditor(f *os.File) {
+    editor := newLineEditor(f, shellOutput, cmd.prompt, completeShellLine)
+    if historyFile := shellHistoryFile(); historyFile != "" {
+        editor.loadHistory(historyFile)
+    }
+
+    for {
+        restore, err := enableRawMode(int(f.Fd()))
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%v\n", err)
+            return
+        }
+        line, err := editor.readLine()
+        restore()
+
+        if err != nil {
+            fmt.Fprintln(shellOutput)
+            return
+        }
+        editor.addHistory(line)
+        if (!runShellLine(line)) {
+            return
+        }
+    }
+}
+
+// Runs a single line of the shell.  Returns false if the shell should exit.
+func runShellLine(line string) bool {
+    tokens, err := splitCommandLine(line)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n", err)
+        return true
+    } else if (len(tokens) == 0) {
+        return true
+    }
+
+    switch tokens[0] {
+    case "exit":
+        return false
+    case "help":
+        if (len(tokens) == 1) {
+            Usage()
+        } else if _, hasCmd := cmds[tokens[1]]; hasCmd {
+            subcommandUsageByName(tokens[1])
+        } else {
+            fmt.Fprintf(os.Stderr, "%s\n", message("unrecognised command: %s", tokens[1]))
+        }
+        return true
+    }
+
+    if err := parseCommand(flag.CommandLine, tokens, 0); err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n", err)
+        if highlight := err.(TryParseError).Highlight(); highlight != "" {
+            fmt.Fprintf(os.Stderr, "%s\n", highlight)
+        }
+        return true
+    }
+    Run()
+    return true
+}
+
+// Splits a command line into arguments using shell-like quoting.  Arguments are separated by
+// whitespace, with single quotes preserving the literal value of the quoted characters, double
+// quotes preserving all but backslash escapes of '"', '\', '$' and '`', and a backslash outside
+// of quotes escaping the following character.
+func splitCommandLine(line string) ([]string, error) {
+    tokens := make([]string, 0)
+    var token bytes.Buffer
+    inToken := false
+    escaped := false
+    var quote rune = 0
+
+    for _, c := range line {
+        switch {
+        case escaped:
+            if (quote == '"') && (c != '"') && (c != '\\') && (c != '$') && (c != '`') {
+                token.WriteRune('\\')
+            }
+            token.WriteRune(c)
+            escaped = false
+        case (c == '\\') && (quote != '\''):
+            escaped = true
+            inToken = true
+        case (quote != 0) && (c == quote):
+            quote = 0
+        case (quote != 0):
+            token.WriteRune(c)
+        case (c == '\'') || (c == '"'):
+            quote = c
+            inToken = true
+        case unicode.IsSpace(c):
+            if (inToken) {
+                tokens = append(tokens, token.String())
+                token.Reset()
+                inToken = false
+            }
+        default:
+            token.WriteRune(c)
+            inToken = true
+        }
+    }
+
+    if (quote != 0) {
+        return nil, errors.New(message("unterminated quote: %c", quote))
+    } else if (escaped) {
+        return nil, errors.New(message("trailing backslash"))
+    }
+
+    if (inToken) {
+        tokens = append(tokens, token.String())
+    }
+    return tokens, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests splitting command lines with quotes and escapes
+func TestSplitCommandLine(t *testing.T) {
+	for _, test := range []struct {
+		line   string
+		tokens []string
+	}{
+		{"", []string{}},
+		{"  cmd  a b ", []string{"cmd", "a", "b"}},
+		{`cmd 'a b' "c d"`, []string{"cmd", "a b", "c d"}},
+		{`cmd a\ b 'c\d' "e\"f\g"`, []string{"cmd", "a b", `c\d`, `e"f\g`}},
+		{`cmd x"y z"'w' ""`, []string{"cmd", "xy zw", ""}},
+	} {
+		tokens, err := splitCommandLine(test.line)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.line, err)
+		} else if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("%s: expected %q, was %q", test.line, test.tokens, tokens)
+		}
+	}
+
+	for _, line := range []string{`cmd 'a`, `cmd "a`, `cmd a\`} {
+		if _, err := splitCommandLine(line); err == nil {
+			t.Errorf("%s: expected error", line)
+		}
+	}
+}
+
+// Tests running commands in the shell
+func TestShell(t *testing.T) {
+	resetForTesting("-global1=hello", "pa", "shell")
+
+	g1 := flag.String("global1", "default-global1", "Description about global1")
+	prearg := PreArg("pa", "this is a prearg")
+	c1 := &testCmd1{}
+	c2 := &testCmd2{}
+	On("command1", "", c1).Arguments("this")
+	On("command2", "", c2)
+	OnShell("")
+	shellInput = strings.NewReader("command1\n\ncommand1 -flag1 'some arg'\nexit\ncommand2\n")
+	shellOutput = ioutil.Discard
+
+	Parse()
+	Run()
+
+	if !c1.run || !*c1.flag1 {
+		t.Error("command 'command1' was expected to run with flag1 set, but it didn't")
+	}
+	if c2.run {
+		t.Error("command 'command2' was not expected to run after exit, but it did")
+	}
+	if *g1 != "hello" || *prearg != "pa" {
+		t.Error("global flags and pre-args expected to be kept for the session")
+	}
+	if matchingCmd != cmds["shell"] {
+		t.Error("matching command expected to be restored after the shell exits")
+	}
+}
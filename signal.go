@@ -0,0 +1,159 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// ContextCmd is a Cmd which is passed a context when run.  The context is cancelled when the
+// program receives an interrupt or termination signal, if signal handling is enabled using
+// `HandleSignals`.  If a command implements ContextCmd, RunContext is called instead of Run.
+type ContextCmd interface {
+    Cmd
+    RunContext(ctx context.Context, args []string)
+}
+
+// Indicates whether or not signals are handled.
+var signalsEnabled bool = false
+
+// The time to wait for a command to return after it is cancelled.
+var signalGracePeriod time.Duration = 0
+
+var signalsInstalled sync.Once
+
+// Guards the running commands and cleanup hooks.
+var signalMutex sync.Mutex
+
+// The commands currently running, with the innermost last.
+var signalRuns []*signalRun = make([]*signalRun, 0)
+
+// The functions to run before exiting because of a signal.
+var cleanupHooks []func() = make([]func(), 0)
+
+// Exits the program because of a signal.  Unlike `exit`, this is not redirected while a batch
+// line runs, as it is called from the signal handler and timer goroutines.
+var signalExit func(code int) = exitProgram
+
+// The signal state of a running command.
+type signalRun struct {
+    cancel      context.CancelFunc
+    interrupted bool
+    timer       *time.Timer
+}
+
+// Enables handling of SIGINT and SIGTERM while running a command.  The first signal cancels
+// the context passed to commands implementing `ContextCmd`.  If the command has not returned
+// after the grace period, the program exits with the status 128 plus the signal number.  A
+// grace period of zero waits for the command indefinitely.  A second signal exits the program
+// immediately with the status 130.  Cleanup hooks registered using `OnCleanup` are run
+// before exiting.
+func HandleSignals(gracePeriod time.Duration) {
+    signalsEnabled = true
+    signalGracePeriod = gracePeriod
+}
+
+// Registers a function to run before the program exits because of a signal.  Cleanup hooks
+// are run in the reverse order they were registered.
+func OnCleanup(hook func()) {
+    signalMutex.Lock()
+    defer signalMutex.Unlock()
+    cleanupHooks = append(cleanupHooks, hook)
+}
+
+// Runs the command, passing it a context which is cancelled on a signal if it is a ContextCmd.
+func runCommand(cont *cmdCont, args []string) {
+    ctx := withDryRun(context.Background())
+    if (signalsEnabled) {
+        signalsInstalled.Do(installSignalHandler)
+
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithCancel(ctx)
+        run := &signalRun{cancel: cancel}
+
+        signalMutex.Lock()
+        signalRuns = append(signalRuns, run)
+        signalMutex.Unlock()
+
+        defer func() {
+            signalMutex.Lock()
+            signalRuns = signalRuns[:len(signalRuns) - 1]
+            if (run.timer != nil) {
+                run.timer.Stop()
+            }
+            signalMutex.Unlock()
+            cancel()
+        }()
+    }
+
+    if cc, isContextCmd := cont.command.(ContextCmd); isContextCmd {
+        cc.RunContext(ctx, args)
+    } else {
+        cont.command.Run(args)
+    }
+}
+
+// Starts listening for signals.
+func installSignalHandler() {
+    signals := make(chan os.Signal, 2)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        for sig := range signals {
+            handleSignal(sig)
+        }
+    }()
+}
+
+// Cancels the innermost running command, or exits if it has already been cancelled.
+func handleSignal(sig os.Signal) {
+    signalMutex.Lock()
+    if (len(signalRuns) == 0) || (signalRuns[len(signalRuns) - 1].interrupted) {
+        signalMutex.Unlock()
+        exitOnSignal(130)
+        return
+    }
+
+    run := signalRuns[len(signalRuns) - 1]
+    run.interrupted = true
+    run.cancel()
+    if (signalGracePeriod > 0) {
+        run.timer = time.AfterFunc(signalGracePeriod, func() {
+            exitOnSignal(signalExitStatus(sig))
+        })
+    }
+    signalMutex.Unlock()
+}
+
+// Runs the cleanup hooks and exits.
+func exitOnSignal(status int) {
+    signalMutex.Lock()
+    hooks := cleanupHooks
+    cleanupHooks = make([]func(), 0)
+    signalMutex.Unlock()
+
+    start := time.Now()
+    for i := len(hooks) - 1; i >= 0; i-- {
+        hooks[i]()
+    }
+    if (len(hooks) > 0) {
+        recordSpan("cleanup", start, nil, nil, nil)
+    }
+    signalExit(status)
+}
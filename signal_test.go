@@ -0,0 +1,127 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"flag"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A command which runs a function with its context.
+type contextCmd func(ctx context.Context)
+
+func (cmd contextCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	return fs
+}
+
+func (cmd contextCmd) Run(args []string) {
+	panic("RunContext expected to be called instead of Run")
+}
+
+func (cmd contextCmd) RunContext(ctx context.Context, args []string) {
+	cmd(ctx)
+}
+
+// Sets up the exit functions to report the exit status on the returned channel.
+func exitForTesting() chan int {
+	exitStatus := make(chan int, 1)
+	exit = func(status int) { exitStatus <- status }
+	signalExit = exit
+	return exitStatus
+}
+
+// Tests that the first signal cancels the command context
+func TestSignalCancelsContext(t *testing.T) {
+	resetForTesting("command1")
+	exitStatus := exitForTesting()
+
+	HandleSignals(0)
+	cancelled := false
+	On("command1", "", contextCmd(func(ctx context.Context) {
+		handleSignal(os.Interrupt)
+		select {
+		case <-ctx.Done():
+			cancelled = true
+		case <-time.After(time.Second):
+		}
+	}))
+	Parse()
+	Run()
+
+	if !cancelled {
+		t.Error("context expected to be cancelled")
+	}
+	select {
+	case status := <-exitStatus:
+		t.Errorf("program not expected to exit, exited with %d", status)
+	default:
+	}
+}
+
+// Tests that a second signal exits after running the cleanup hooks
+func TestSecondSignalExits(t *testing.T) {
+	resetForTesting("command1")
+	exitStatus := exitForTesting()
+
+	HandleSignals(0)
+	hooks := make([]int, 0)
+	OnCleanup(func() { hooks = append(hooks, 1) })
+	OnCleanup(func() { hooks = append(hooks, 2) })
+	On("command1", "", contextCmd(func(ctx context.Context) {
+		handleSignal(os.Interrupt)
+		handleSignal(syscall.SIGTERM)
+	}))
+	Parse()
+	Run()
+
+	if status := <-exitStatus; status != 130 {
+		t.Errorf("exit status expected to be 130, was %d", status)
+	}
+	if !reflect.DeepEqual(hooks, []int{2, 1}) {
+		t.Errorf("cleanup hooks expected to run in reverse order, ran %v", hooks)
+	}
+}
+
+// Tests that the program exits if the command does not return within the grace period
+func TestSignalGracePeriod(t *testing.T) {
+	resetForTesting("command1")
+	exitStatus := exitForTesting()
+
+	HandleSignals(10 * time.Millisecond)
+	On("command1", "", contextCmd(func(ctx context.Context) {
+		handleSignal(syscall.SIGTERM)
+		select {
+		case status := <-exitStatus:
+			exitStatus <- status
+		case <-time.After(time.Second):
+		}
+	}))
+	Parse()
+	Run()
+
+	select {
+	case status := <-exitStatus:
+		if status != signalExitStatus(syscall.SIGTERM) {
+			t.Errorf("exit status expected to be %d, was %d", signalExitStatus(syscall.SIGTERM), status)
+		}
+	default:
+		t.Error("program expected to exit after the grace period")
+	}
+}
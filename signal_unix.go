@@ -0,0 +1,32 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package command
+
+import (
+    "os"
+    "syscall"
+)
+
+// Returns the conventional exit status of a program terminated by the signal, which is 128 plus
+// the signal number.
+func signalExitStatus(sig os.Signal) int {
+    if s, isSyscallSignal := sig.(syscall.Signal); isSyscallSignal {
+        return 128 + int(s)
+    }
+    return 130
+}
@@ -0,0 +1,29 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package command
+
+import (
+	"syscall"
+	"testing"
+)
+
+// Tests that the exit status for a signal is 128 plus the signal number
+func TestSignalExitStatus(t *testing.T) {
+	if status := signalExitStatus(syscall.SIGTERM); status != 128+int(syscall.SIGTERM) {
+		t.Errorf("exit status expected to be %d, was %d", 128+int(syscall.SIGTERM), status)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io/ioutil"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// A declarative description of the commands of a program.
+type Spec struct {
+    Commands    []CommandSpec   `json:"commands" yaml:"commands"`
+}
+
+// A declarative description of a command.
+type CommandSpec struct {
+    // The command name.
+    Name        string          `json:"name" yaml:"name"`
+
+    // The name of the handler which runs the command.  Defaults to the command name.
+    Handler     string          `json:"handler,omitempty" yaml:"handler,omitempty"`
+
+    // The description shown in the command listing.
+    Description string          `json:"description" yaml:"description"`
+
+    // The long description shown in the command usage.
+    Long        string          `json:"long,omitempty" yaml:"long,omitempty"`
+
+    // The argument names, in the format accepted by `CmdBuilder.Arguments`.
+    Arguments   []string        `json:"arguments,omitempty" yaml:"arguments,omitempty"`
+
+    // The command flags.
+    Flags       []FlagSpec      `json:"flags,omitempty" yaml:"flags,omitempty"`
+
+    // The worked examples shown in the command usage.
+    Examples    []ExampleSpec   `json:"examples,omitempty" yaml:"examples,omitempty"`
+}
+
+// A declarative description of a command flag.
+type FlagSpec struct {
+    // The flag name.
+    Name        string          `json:"name" yaml:"name"`
+
+    // The flag type, which is one of 'string', 'bool', 'int', 'float' or 'duration'.  Defaults
+    // to 'string'.
+    Type        string          `json:"type,omitempty" yaml:"type,omitempty"`
+
+    // The default value of the flag.
+    Default     string          `json:"default,omitempty" yaml:"default,omitempty"`
+
+    // The flag usage.
+    Usage       string          `json:"usage" yaml:"usage"`
+
+    // Whether or not the flag is required.
+    Required    bool            `json:"required,omitempty" yaml:"required,omitempty"`
+
+    // The single character short alias, used with POSIX style flags.
+    Short       string          `json:"short,omitempty" yaml:"short,omitempty"`
+
+    // The values the flag is restricted to.
+    Choices     []string        `json:"choices,omitempty" yaml:"choices,omitempty"`
+}
+
+// A declarative description of a worked example.
+type ExampleSpec struct {
+    Cmdline     string          `json:"cmdline" yaml:"cmdline"`
+    Explanation string          `json:"explanation,omitempty" yaml:"explanation,omitempty"`
+}
+
+// Runs a command declared in a spec.  The flag set contains the command flags declared in the
+// spec, and args are the command arguments.
+type SpecHandler func(flags *flag.FlagSet, args []string)
+
+// Loads a spec and registers its commands, binding them to the handlers by name.  The spec is
+// decoded using unmarshal, which can be a YAML decoder such as `yaml.Unmarshal`.  If unmarshal
+// is nil, the spec is decoded as JSON, with unknown fields rejected.  An error is returned, and
+// no commands are registered, if the spec is invalid, a command has no handler, or a handler
+// is not used by any command.
+func LoadSpec(data []byte, unmarshal func([]byte, interface{}) error, handlers map[string]SpecHandler) error {
+    var spec Spec
+    if (unmarshal != nil) {
+        if err := unmarshal(data, &spec); err != nil {
+            return fmt.Errorf("spec: %v", err)
+        }
+    } else {
+        decoder := json.NewDecoder(bytes.NewReader(data))
+        decoder.DisallowUnknownFields()
+        if err := decoder.Decode(&spec); err != nil {
+            return fmt.Errorf("spec: %v", err)
+        }
+    }
+
+    if err := spec.validate(handlers); err != nil {
+        return err
+    }
+
+    for _, cs := range spec.Commands {
+        cs.register(handlers[cs.handlerName()])
+    }
+    return nil
+}
+
+// Reads a JSON spec from a file and registers its commands.  See `LoadSpec`.
+func LoadSpecFile(filename string, handlers map[string]SpecHandler) error {
+    data, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return err
+    }
+    return LoadSpec(data, nil, handlers)
+}
+
+// Checks the spec against the handlers, returning an error describing all the problems.
+func (spec Spec) validate(handlers map[string]SpecHandler) error {
+    problems := make([]string, 0)
+    usedHandlers := make(map[string]bool)
+    names := make(map[string]bool)
+
+    for _, cs := range spec.Commands {
+        if (cs.Name == "") {
+            problems = append(problems, "command with no name")
+            continue
+        } else if (names[cs.Name]) {
+            problems = append(problems, "duplicate command: " + cs.Name)
+        }
+        names[cs.Name] = true
+
+        if _, hasHandler := handlers[cs.handlerName()]; !hasHandler {
+            problems = append(problems, fmt.Sprintf("command %s: no handler named %s", cs.Name, cs.handlerName()))
+        }
+        usedHandlers[cs.handlerName()] = true
+
+        if err := defineSpecFlags(flag.NewFlagSet(cs.Name, flag.ContinueOnError), cs.Flags); err != nil {
+            problems = append(problems, fmt.Sprintf("command %s: %v", cs.Name, err))
+        }
+        if err := validateSpecArguments(cs.Arguments); err != nil {
+            problems = append(problems, fmt.Sprintf("command %s: %v", cs.Name, err))
+        }
+    }
+
+    unusedHandlers := make([]string, 0)
+    for name := range handlers {
+        if (!usedHandlers[name]) {
+            unusedHandlers = append(unusedHandlers, name)
+        }
+    }
+    sort.Strings(unusedHandlers)
+    for _, name := range unusedHandlers {
+        problems = append(problems, "handler with no command: " + name)
+    }
+
+    if (len(problems) > 0) {
+        return fmt.Errorf("spec: %s", strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+func (cs CommandSpec) handlerName() string {
+    if (cs.Handler != "") {
+        return cs.Handler
+    }
+    return cs.Name
+}
+
+// Registers the command using the handler.
+func (cs CommandSpec) register(handler SpecHandler) {
+    cb := On(cs.Name, cs.Description, &specCmd{flags: cs.Flags, handler: handler})
+    if (cs.Long != "") {
+        cb.Long(cs.Long)
+    }
+    if (len(cs.Arguments) > 0) {
+        cb.Arguments(cs.Arguments...)
+    }
+    for _, fspec := range cs.Flags {
+        if (fspec.Required) {
+            cb.RequiredFlags(fspec.Name)
+        }
+        if (fspec.Short != "") {
+            cb.ShortFlag(fspec.Short, fspec.Name)
+        }
+        if (len(fspec.Choices) > 0) {
+            cb.FlagChoices(fspec.Name, fspec.Choices...)
+        }
+    }
+    for _, example := range cs.Examples {
+        cb.Example(example.Cmdline, example.Explanation)
+    }
+}
+
+// Checks that the argument patterns are well formed: a name, an optional name in square
+// brackets, or '...' as the last pattern.
+func validateSpecArguments(argPatterns []string) error {
+    for i, argPattern := range argPatterns {
+        name := argPattern
+        if strings.HasPrefix(argPattern, "[") || strings.HasSuffix(argPattern, "]") {
+            if !strings.HasPrefix(argPattern, "[") || !strings.HasSuffix(argPattern, "]") {
+                return fmt.Errorf("invalid argument: %q", argPattern)
+            }
+            name = argPattern[1:len(argPattern) - 1]
+        } else if (argPattern == "...") && (i < len(argPatterns) - 1) {
+            return fmt.Errorf("argument ... must be last")
+        }
+        if (strings.TrimSpace(name) == "") {
+            return fmt.Errorf("argument with no name")
+        }
+    }
+    return nil
+}
+
+// Defines the flags in the flag set.
+func defineSpecFlags(fs *flag.FlagSet, flags []FlagSpec) error {
+    for _, fspec := range flags {
+        if (fspec.Name == "") {
+            return fmt.Errorf("flag with no name")
+        } else if (fs.Lookup(fspec.Name) != nil) {
+            return fmt.Errorf("duplicate flag: %s", fspec.Name)
+        }
+
+        var err error
+        switch fspec.Type {
+        case "", "string":
+            fs.String(fspec.Name, fspec.Default, fspec.Usage)
+        case "bool":
+            var val bool
+            if val, err = strconv.ParseBool(defaultOr(fspec.Default, "false")); err == nil {
+                fs.Bool(fspec.Name, val, fspec.Usage)
+            }
+        case "int":
+            var val int
+            if val, err = strconv.Atoi(defaultOr(fspec.Default, "0")); err == nil {
+                fs.Int(fspec.Name, val, fspec.Usage)
+            }
+        case "float":
+            var val float64
+            if val, err = strconv.ParseFloat(defaultOr(fspec.Default, "0"), 64); err == nil {
+                fs.Float64(fspec.Name, val, fspec.Usage)
+            }
+        case "duration":
+            var val time.Duration
+            if val, err = time.ParseDuration(defaultOr(fspec.Default, "0s")); err == nil {
+                fs.Duration(fspec.Name, val, fspec.Usage)
+            }
+        default:
+            return fmt.Errorf("flag %s: unknown type %s", fspec.Name, fspec.Type)
+        }
+        if err != nil {
+            return fmt.Errorf("flag %s: invalid default %q", fspec.Name, fspec.Default)
+        }
+    }
+    return nil
+}
+
+func defaultOr(val, def string) string {
+    if (val == "") {
+        return def
+    }
+    return val
+}
+
+// A command declared in a spec.
+type specCmd struct {
+    flags       []FlagSpec
+    handler     SpecHandler
+    fs          *flag.FlagSet
+}
+
+func (cmd *specCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+    // The flags are checked when the spec is loaded
+    defineSpecFlags(fs, cmd.flags)
+    cmd.fs = fs
+    return fs
+}
+
+func (cmd *specCmd) Run(args []string) {
+    cmd.handler(cmd.fs, args)
+}
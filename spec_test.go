@@ -0,0 +1,112 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSpec = `{
+	"commands": [
+		{
+			"name": "deploy",
+			"description": "deploys the application",
+			"long": "Deploys the application to the environment.",
+			"arguments": ["env", "[version]"],
+			"flags": [
+				{"name": "timeout", "type": "duration", "default": "30s", "usage": "the deploy timeout"},
+				{"name": "user", "usage": "the user", "required": true},
+				{"name": "format", "usage": "the output format", "choices": ["text", "json"], "default": "text"}
+			],
+			"examples": [{"cmdline": "deploy -user=bob prod", "explanation": "deploys to prod"}]
+		},
+		{"name": "status", "handler": "showStatus", "description": "shows the status"}
+	]
+}`
+
+// Tests loading a spec and running a command
+func TestLoadSpec(t *testing.T) {
+	resetForTesting("deploy", "-user=bob", "-timeout=1m", "prod")
+
+	var timeout time.Duration
+	var user string
+	var deployArgs []string
+	err := LoadSpec([]byte(testSpec), nil, map[string]SpecHandler{
+		"deploy": func(fs *flag.FlagSet, args []string) {
+			timeout = fs.Lookup("timeout").Value.(flag.Getter).Get().(time.Duration)
+			user = fs.Lookup("user").Value.String()
+			deployArgs = args
+		},
+		"showStatus": func(fs *flag.FlagSet, args []string) {},
+	})
+	if err != nil {
+		t.Fatal("spec expected to load, was", err)
+	}
+
+	if cmds["deploy"].long == "" || len(cmds["deploy"].requiredFlags) != 1 || cmds["status"] == nil {
+		t.Error("commands expected to be registered from the spec")
+	}
+	if err := CheckExamples(); err != nil {
+		t.Error("spec examples expected to be valid, was", err)
+	}
+
+	res := TryParse()
+	if res != nil {
+		t.Error("Try parse must be OK, was", res)
+	}
+	Run()
+	if timeout != time.Minute || user != "bob" || len(deployArgs) != 1 || deployArgs[0] != "prod" {
+		t.Errorf("handler expected to run with flags and args, was %v %s %v", timeout, user, deployArgs)
+	}
+}
+
+// Tests that the spec and handlers must match
+func TestLoadSpecMismatch(t *testing.T) {
+	resetForTesting()
+
+	err := LoadSpec([]byte(testSpec), nil, map[string]SpecHandler{
+		"deploy": func(fs *flag.FlagSet, args []string) {},
+		"other":  func(fs *flag.FlagSet, args []string) {},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no handler named showStatus") || !strings.Contains(err.Error(), "handler with no command: other") {
+		t.Error("spec expected to fail with mismatched handlers, was", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("no commands expected to be registered from an invalid spec")
+	}
+}
+
+// Tests invalid specs
+func TestLoadSpecInvalid(t *testing.T) {
+	handlers := map[string]SpecHandler{"cmd": func(fs *flag.FlagSet, args []string) {}}
+	for _, spec := range []string{
+		`{"commands": [{"name": "cmd", "descripton": "typo"}]}`,
+		`{"commands": [{"name": "cmd", "flags": [{"name": "f", "type": "complex"}]}]}`,
+		`{"commands": [{"name": "cmd", "flags": [{"name": "f", "type": "int", "default": "abc"}]}]}`,
+		`{"commands": [{"name": "cmd"}, {"name": "cmd"}]}`,
+		`{"commands": [{"name": "cmd", "arguments": [""]}]}`,
+		`{"commands": [{"name": "cmd", "arguments": ["[]"]}]}`,
+		`{"commands": [{"name": "cmd", "arguments": ["[version"]}]}`,
+		`{"commands": [{"name": "cmd", "arguments": ["...", "file"]}]}`,
+	} {
+		resetForTesting()
+		if err := LoadSpec([]byte(spec), nil, handlers); err == nil {
+			t.Errorf("%s: spec expected to fail", spec)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package command
+
+import "errors"
+
+// Terminals are not supported on this platform.
+func isTerminal(fd int) bool {
+    return false
+}
+
+// Terminals are not supported on this platform.
+func terminalWidth(fd int) int {
+    return 0
+}
+
+// Terminals are not supported on this platform.
+func enableRawMode(fd int) (func(), error) {
+    return nil, errors.New("raw mode not supported")
+}
+
+// Terminals are not supported on this platform.
+func disableEcho(fd int) (func(), error) {
+    return nil, errors.New("disabling echo not supported")
+}
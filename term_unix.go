@@ -0,0 +1,108 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package command
+
+import (
+    "syscall"
+    "unsafe"
+)
+
+// Reads the terminal attributes of the file descriptor.
+func getTermios(fd int) (*syscall.Termios, error) {
+    termios := &syscall.Termios{}
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlReadTermios, uintptr(unsafe.Pointer(termios)))
+    if (errno != 0) {
+        return nil, errno
+    }
+    return termios, nil
+}
+
+// Sets the terminal attributes of the file descriptor.
+func setTermios(fd int, termios *syscall.Termios) error {
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlWriteTermios, uintptr(unsafe.Pointer(termios)))
+    if (errno != 0) {
+        return errno
+    }
+    return nil
+}
+
+// Returns true if the file descriptor refers to a terminal.
+func isTerminal(fd int) bool {
+    _, err := getTermios(fd)
+    return err == nil
+}
+
+// The window size of a terminal.
+type winsize struct {
+    rows        uint16
+    cols        uint16
+    xpixel      uint16
+    ypixel      uint16
+}
+
+// Returns the width of the terminal in columns, or 0 if the file descriptor does not refer to
+// a terminal.
+func terminalWidth(fd int) int {
+    ws := &winsize{}
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(ws)))
+    if (errno != 0) {
+        return 0
+    }
+    return int(ws.cols)
+}
+
+// Disables echo on the terminal.  Returns a function which restores the previous terminal
+// attributes.
+func disableEcho(fd int) (func(), error) {
+    oldTermios, err := getTermios(fd)
+    if err != nil {
+        return nil, err
+    }
+
+    termios := *oldTermios
+    termios.Lflag &^= syscall.ECHO
+    termios.Lflag |= syscall.ICANON | syscall.ISIG
+    if err := setTermios(fd, &termios); err != nil {
+        return nil, err
+    }
+
+    return func() { setTermios(fd, oldTermios) }, nil
+}
+
+// Puts the terminal into raw mode, so that input is read a key at a time without echo.  Output
+// processing is left on so that newlines are still translated.  Returns a function which
+// restores the previous terminal attributes.
+func enableRawMode(fd int) (func(), error) {
+    oldTermios, err := getTermios(fd)
+    if err != nil {
+        return nil, err
+    }
+
+    termios := *oldTermios
+    termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+    termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+    termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+    termios.Cflag |= syscall.CS8
+    termios.Cc[syscall.VMIN] = 1
+    termios.Cc[syscall.VTIME] = 0
+    if err := setTermios(fd, &termios); err != nil {
+        return nil, err
+    }
+
+    return func() { setTermios(fd, oldTermios) }, nil
+}
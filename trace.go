@@ -0,0 +1,222 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "bufio"
+    "errors"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+)
+
+// The formats the trace can be written in.
+const (
+    TraceJSONLines  = "jsonl"
+    TraceChrome     = "chrome"
+)
+
+// The trace file and format global flags, or nil if tracing is not enabled.
+var traceFile *string = nil
+var traceFormat *string = nil
+
+// Guards the recorded spans.
+var traceMutex sync.Mutex
+
+// The spans recorded so far.
+var traceSpans []traceSpan = make([]traceSpan, 0)
+
+// The commands currently running whose run spans are not yet recorded, with the innermost last.
+var traceRuns []*traceRun = make([]*traceRun, 0)
+
+// A command which is running.
+type traceRun struct {
+    cont        *cmdCont
+    args        []string
+    start       time.Time
+}
+
+// A timed phase of running the program.
+type traceSpan struct {
+    Name        string          `json:"name"`
+    Command     string          `json:"command,omitempty"`
+    Args        []string        `json:"args,omitempty"`
+    Start       time.Time       `json:"start"`
+    Duration    time.Duration   `json:"durationNs"`
+    Error       string          `json:"error,omitempty"`
+}
+
+// An event of the Chrome trace-event format.
+type chromeTraceEvent struct {
+    Name        string                  `json:"name"`
+    Category    string                  `json:"cat"`
+    Phase       string                  `json:"ph"`
+    Timestamp   int64                   `json:"ts"`
+    Duration    int64                   `json:"dur"`
+    Pid         int                     `json:"pid"`
+    Tid         int                     `json:"tid"`
+    Args        map[string]interface{}  `json:"args,omitempty"`
+}
+
+// Registers the global flags '-trace-file', which names the file timing spans are written to,
+// and '-trace-format', which is either "jsonl" for a JSON object per span or "chrome" for the
+// Chrome trace-event format used by chrome://tracing and Perfetto.  Spans are recorded for
+// parsing the command line, running the command and running the cleanup hooks, and the file is
+// written once the command has run, or when it exits using `Exit`.
+func EnableTracing() {
+    traceFile = flag.String("trace-file", "", "Writes timing spans to the file")
+    traceFormat = flag.String("trace-format", TraceJSONLines, "The format of the trace file: jsonl or chrome")
+}
+
+// Returns true if the trace file is set.
+func tracing() bool {
+    return (traceFile != nil) && (*traceFile != "")
+}
+
+// Records a span which started at start and ends now.
+func recordSpan(name string, start time.Time, cont *cmdCont, args []string, err error) {
+    if (!tracing()) {
+        return
+    }
+
+    span := traceSpan{Name: name, Args: args, Start: start, Duration: time.Since(start)}
+    if (cont != nil) {
+        span.Command = cont.name
+    }
+    if (err != nil) {
+        span.Error = err.Error()
+    }
+
+    traceMutex.Lock()
+    traceSpans = append(traceSpans, span)
+    traceMutex.Unlock()
+}
+
+// Starts timing a run of the command.
+func startRun(cont *cmdCont, args []string) *traceRun {
+    run := &traceRun{cont, args, time.Now()}
+    traceMutex.Lock()
+    traceRuns = append(traceRuns, run)
+    traceMutex.Unlock()
+    return run
+}
+
+// Records the run span once the command returns or panics, and writes the trace.  The span is
+// not recorded again if it was recorded when exiting.
+func finishRun(run *traceRun) {
+    traceMutex.Lock()
+    open := (len(traceRuns) > 0) && (traceRuns[len(traceRuns) - 1] == run)
+    if (open) {
+        traceRuns = traceRuns[:len(traceRuns) - 1]
+    }
+    traceMutex.Unlock()
+
+    if (open) {
+        recordSpan("run", run.start, run.cont, run.args, nil)
+    }
+    writeTrace()
+}
+
+// Records the run spans of the commands still running, innermost first, and writes the trace
+// before the program exits with the status.
+func finishTrace(status int) {
+    traceMutex.Lock()
+    runs := traceRuns
+    traceRuns = make([]*traceRun, 0)
+    traceMutex.Unlock()
+
+    var err error
+    if (status != 0) {
+        err = fmt.Errorf("exit status %d", status)
+    }
+    for i := len(runs) - 1; i >= 0; i-- {
+        recordSpan("run", runs[i].start, runs[i].cont, runs[i].args, err)
+    }
+    writeTrace()
+}
+
+// Writes the spans recorded so far to the trace file, replacing its contents.  Errors are
+// reported on stderr rather than failing the command.
+func writeTrace() {
+    if (!tracing()) {
+        return
+    }
+
+    traceMutex.Lock()
+    spans := append([]traceSpan(nil), traceSpans...)
+    traceMutex.Unlock()
+
+    if err := writeTraceFile(*traceFile, *traceFormat, spans); err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+    }
+}
+
+// Writes the spans to the file in the format.
+func writeTraceFile(filename, format string, spans []traceSpan) error {
+    if (format != TraceJSONLines) && (format != TraceChrome) {
+        return errors.New(message("invalid trace format: %s", format))
+    }
+
+    f, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+    encoder := json.NewEncoder(w)
+
+    if (format == TraceJSONLines) {
+        for _, span := range spans {
+            if err = encoder.Encode(span); err != nil {
+                break
+            }
+        }
+    } else {
+        events := make([]chromeTraceEvent, 0, len(spans))
+        for _, span := range spans {
+            eventArgs := make(map[string]interface{})
+            if (span.Command != "") {
+                eventArgs["command"] = span.Command
+            }
+            if (len(span.Args) > 0) {
+                eventArgs["args"] = span.Args
+            }
+            if (span.Error != "") {
+                eventArgs["error"] = span.Error
+            }
+            events = append(events, chromeTraceEvent{
+                Name:       span.Name,
+                Category:   "command",
+                Phase:      "X",
+                Timestamp:  span.Start.UnixNano() / int64(time.Microsecond),
+                Duration:   int64(span.Duration / time.Microsecond),
+                Pid:        os.Getpid(),
+                Tid:        1,
+                Args:       eventArgs,
+            })
+        }
+        err = encoder.Encode(map[string]interface{}{"traceEvents": events, "displayTimeUnit": "ms"})
+    }
+
+    if err == nil {
+        err = w.Flush()
+    }
+    if closeErr := f.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
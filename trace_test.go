@@ -0,0 +1,132 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests writing the parse and run spans as JSON lines
+func TestTraceJSONLines(t *testing.T) {
+	traceFilename := filepath.Join(t.TempDir(), "trace.jsonl")
+	resetForTesting("-trace-file=" + traceFilename, "command1", "foo")
+	EnableTracing()
+	On("command1", "", &testCmd1{}).Arguments("this")
+
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	Run()
+
+	f, err := os.Open(traceFilename)
+	if err != nil {
+		t.Fatal("trace file must be written, was", err)
+	}
+	defer f.Close()
+
+	spans := make([]traceSpan, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span traceSpan
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatal("each line must be a JSON span, was", err)
+		}
+		spans = append(spans, span)
+	}
+
+	if len(spans) != 2 || spans[0].Name != "parse" || spans[1].Name != "run" {
+		t.Fatalf("parse and run spans expected, was %+v", spans)
+	}
+	if spans[1].Command != "command1" || len(spans[1].Args) != 1 || spans[1].Args[0] != "foo" {
+		t.Errorf("run span must record the command and args, was %+v", spans[1])
+	}
+}
+
+// Tests writing a failed parse in the Chrome trace-event format
+func TestTraceChrome(t *testing.T) {
+	traceFilename := filepath.Join(t.TempDir(), "trace.json")
+	resetForTesting("-trace-file=" + traceFilename, "-trace-format=chrome", "command2")
+	EnableTracing()
+	On("command1", "", &testCmd1{})
+
+	if err := TryParse(); err == nil {
+		t.Fatal("try parse must fail for an invalid command")
+	}
+
+	data, err := os.ReadFile(traceFilename)
+	if err != nil {
+		t.Fatal("trace file must be written, was", err)
+	}
+	var trace struct {
+		TraceEvents []chromeTraceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatal("trace must be valid JSON, was", err)
+	}
+	if len(trace.TraceEvents) != 1 || trace.TraceEvents[0].Name != "parse" || trace.TraceEvents[0].Phase != "X" {
+		t.Fatalf("a complete parse event expected, was %+v", trace.TraceEvents)
+	}
+	if trace.TraceEvents[0].Args["error"] != "invalid command: command2" {
+		t.Errorf("parse event must record the error, was %+v", trace.TraceEvents[0].Args)
+	}
+}
+
+// Tests that the run span is recorded when the command exits with a non-zero status
+func TestTraceExit(t *testing.T) {
+	traceFilename := filepath.Join(t.TempDir(), "trace.jsonl")
+	resetForTesting("-trace-file=" + traceFilename, "exit", "3")
+	EnableTracing()
+	exitStatus := 0
+	osExit = func(code int) { exitStatus = code }
+	On("exit", "", exitCmd{}).Arguments("status")
+
+	if err := TryParse(); err != nil {
+		t.Fatal("try parse must succeed, was", err)
+	}
+	Run()
+
+	data, err := os.ReadFile(traceFilename)
+	if err != nil {
+		t.Fatal("trace file must be written, was", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var span traceSpan
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &span) != nil {
+		t.Fatalf("parse and run spans expected, was %q", lines)
+	}
+	if span.Name != "run" || span.Error != "exit status 3" {
+		t.Errorf("run span must record the exit status, was %+v", span)
+	}
+	if exitStatus != 3 {
+		t.Errorf("exit status expected to be 3, was %d", exitStatus)
+	}
+}
+
+// Tests that nothing is recorded unless the trace file is set
+func TestTraceDisabled(t *testing.T) {
+	resetForTesting("command1")
+	EnableTracing()
+	On("command1", "", &testCmd1{})
+	TryParse()
+	Run()
+	if len(traceSpans) != 0 {
+		t.Errorf("spans must not be recorded without a trace file, was %+v", traceSpans)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "runtime/debug"
+    "strings"
+    "unicode/utf8"
+)
+
+// Build metadata reported by the version command.  These are intended to be set using the
+// linker, for example:
+//
+//      go build -ldflags "-X github.com/rakyll/command.Version=1.2.0 -X github.com/rakyll/command.Commit=abc123"
+//
+// Values which are not set are taken from the build information embedded by the Go toolchain
+// where available.
+var (
+    Version     string
+    Commit      string
+    BuildDate   string
+)
+
+// The name of the global flag which prints the version.
+const versionFlagName = "version"
+
+// Indicates whether or not the version builtin is enabled.
+var versionEnabled bool = false
+
+// Where the version is written.
+var versionOutput io.Writer = os.Stdout
+
+// Returns the build information embedded by the Go toolchain.
+var readBuildInfo func() (*debug.BuildInfo, bool) = debug.ReadBuildInfo
+
+// The build metadata of the program.
+type VersionInfo struct {
+    Version     string      `json:"version"`
+    Commit      string      `json:"commit,omitempty"`
+    BuildDate   string      `json:"buildDate,omitempty"`
+    GoVersion   string      `json:"goVersion"`
+    Modified    bool        `json:"modified,omitempty"`
+}
+
+// Registers a version command which prints the version, commit, build date and Go version of
+// the program, and a global '-version' flag which does the same without a command.  The
+// command accepts '-short' to print only the version and '-json' to print the build metadata
+// as JSON.
+func OnVersion() {
+    versionEnabled = true
+    if (flag.Lookup(versionFlagName) == nil) {
+        flag.Bool(versionFlagName, false, "Prints the version and exits")
+    }
+    On("version", "Prints the version", &versionCmd{}).SupportsDryRun().
+        Long("Prints the version, commit, build date and Go version of the program. Use " +
+            "-short to print only the version, or -json to print the build metadata as JSON.")
+}
+
+// Returns the build metadata of the program.  The linker variables take precedence over the
+// build information embedded by the Go toolchain.
+func ReadVersionInfo() VersionInfo {
+    info := VersionInfo{Version: Version, Commit: Commit, BuildDate: BuildDate}
+
+    if buildInfo, ok := readBuildInfo(); ok {
+        info.GoVersion = buildInfo.GoVersion
+        if (info.Version == "") && (buildInfo.Main.Version != "(devel)") {
+            info.Version = buildInfo.Main.Version
+        }
+        for _, setting := range buildInfo.Settings {
+            switch setting.Key {
+            case "vcs.revision":
+                if (info.Commit == "") {
+                    info.Commit = setting.Value
+                }
+            case "vcs.time":
+                if (info.BuildDate == "") {
+                    info.BuildDate = setting.Value
+                }
+            case "vcs.modified":
+                info.Modified = (setting.Value == "true")
+            }
+        }
+    }
+
+    if (info.Version == "") {
+        info.Version = "unknown"
+    }
+    return info
+}
+
+// Returns true if the global version flag is set in the flag set.
+func versionRequested(fs *flag.FlagSet) bool {
+    if (!versionEnabled) {
+        return false
+    }
+    f := fs.Lookup(versionFlagName)
+    return (f != nil) && (f.Value.String() == "true")
+}
+
+// Builtin command for printing the version.
+type versionCmd struct {
+    json        *bool
+    short       *bool
+}
+
+func (cmd *versionCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+    cmd.json = fs.Bool("json", false, "Prints the build metadata as JSON")
+    cmd.short = fs.Bool("short", false, "Prints only the version")
+    return fs
+}
+
+func (cmd *versionCmd) Run(_ []string) {
+    info := ReadVersionInfo()
+
+    switch {
+    case (cmd.json != nil) && *cmd.json:
+        encoder := json.NewEncoder(versionOutput)
+        encoder.SetIndent("", "  ")
+        encoder.Encode(info)
+    case (cmd.short != nil) && *cmd.short:
+        fmt.Fprintln(versionOutput, info.Version)
+    default:
+        fmt.Fprintln(versionOutput, message("%s version %s", filepath.Base(os.Args[0]), info.Version))
+        rows := make([][2]string, 0, 3)
+        if (info.Commit != "") {
+            commit := info.Commit
+            if (info.Modified) {
+                commit += " (" + message("modified") + ")"
+            }
+            rows = append(rows, [2]string{message("commit:"), commit})
+        }
+        if (info.BuildDate != "") {
+            rows = append(rows, [2]string{message("built:"), info.BuildDate})
+        }
+        rows = append(rows, [2]string{message("go version:"), info.GoVersion})
+
+        // Align the values after the longest label, which may be translated
+        labelWidth := 0
+        for _, row := range rows {
+            if width := utf8.RuneCountInString(row[0]); width > labelWidth {
+                labelWidth = width
+            }
+        }
+        for _, row := range rows {
+            padding := strings.Repeat(" ", labelWidth - utf8.RuneCountInString(row[0]) + 1)
+            fmt.Fprintf(versionOutput, "  %s%s%s\n", row[0], padding, row[1])
+        }
+    }
+}
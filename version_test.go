@@ -0,0 +1,135 @@
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime/debug"
+	"testing"
+)
+
+// Replaces the build information with a fixed one and captures the version output.
+func versionForTesting(args ...string) *bytes.Buffer {
+	resetForTesting(args...)
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			GoVersion: "go1.99",
+			Main:      debug.Module{Version: "(devel)"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "abc123"},
+				{Key: "vcs.time", Value: "2020-01-02T03:04:05Z"},
+				{Key: "vcs.modified", Value: "true"},
+			},
+		}, true
+	}
+	out := new(bytes.Buffer)
+	versionOutput = out
+	OnVersion()
+	return out
+}
+
+// Tests the default version output
+func TestVersionCommand(t *testing.T) {
+	out := versionForTesting("version")
+	Version = "1.2.0"
+
+	if err := TryParse(); err != nil {
+		t.Fatal("version command must parse, was", err)
+	}
+	Run()
+
+	expected := "cmd version 1.2.0\n" +
+		"  commit:     abc123 (modified)\n" +
+		"  built:      2020-01-02T03:04:05Z\n" +
+		"  go version: go1.99\n"
+	if out.String() != expected {
+		t.Errorf("unexpected version output:\n%s", out.String())
+	}
+}
+
+// Tests the short and JSON version output
+func TestVersionCommandModes(t *testing.T) {
+	out := versionForTesting("version", "-short")
+	Commit = "def456"
+	TryParse()
+	Run()
+	if out.String() != "unknown\n" {
+		t.Errorf("short version expected, was %q", out.String())
+	}
+
+	out = versionForTesting("version", "-json")
+	Commit = "def456"
+	TryParse()
+	Run()
+	var info VersionInfo
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatal("version must be valid JSON, was", err)
+	}
+	expected := VersionInfo{Version: "unknown", Commit: "def456", BuildDate: "2020-01-02T03:04:05Z", GoVersion: "go1.99", Modified: true}
+	if info != expected {
+		t.Errorf("version info expected to be %+v, was %+v", expected, info)
+	}
+}
+
+// Tests the global version flag
+func TestVersionFlag(t *testing.T) {
+	out := versionForTesting("-version")
+	Version = "1.2.0"
+	PreArg("pa", "")
+
+	if err := TryParse(); err != nil {
+		t.Fatal("version flag must parse without pre-args or a command, was", err)
+	}
+	Run()
+	if !bytes.HasPrefix(out.Bytes(), []byte("cmd version 1.2.0\n")) {
+		t.Errorf("version expected, was %q", out.String())
+	}
+}
+
+// Tests that the version command does not add examples which need the program's pre-args
+func TestVersionCheckExamples(t *testing.T) {
+	versionForTesting()
+	PreArg("pa", "")
+
+	if err := CheckExamples(); err != nil {
+		t.Error("examples must be valid, was", err)
+	}
+}
+
+// Tests that the version labels are translated and aligned
+func TestVersionTranslated(t *testing.T) {
+	out := versionForTesting("version")
+	Version = "1.2.0"
+	AddCatalog("de", MapCatalog{
+		"commit:":     "Commit:",
+		"built:":      "Erstellt am:",
+		"go version:": "Go-Version:",
+	})
+	SetLocale("de")
+
+	if err := TryParse(); err != nil {
+		t.Fatal("version command must parse, was", err)
+	}
+	Run()
+
+	expected := "cmd version 1.2.0\n" +
+		"  Commit:      abc123 (modified)\n" +
+		"  Erstellt am: 2020-01-02T03:04:05Z\n" +
+		"  Go-Version:  go1.99\n"
+	if out.String() != expected {
+		t.Errorf("unexpected version output:\n%s", out.String())
+	}
+}